@@ -2,41 +2,278 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
 	"fmt"
 	"html/template"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
 	"io/fs"
+	"mime"
+	"net/url"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 
 	"sort"
 	"strconv"
 	"strings"
+	"text/template/parse"
 	"time"
-
+	"unicode"
+	"unicode/utf8"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/tdewolff/minify/v2"
+	minifycss "github.com/tdewolff/minify/v2/css"
+	minifyhtml "github.com/tdewolff/minify/v2/html"
+	minifyjs "github.com/tdewolff/minify/v2/js"
+	minifyjson "github.com/tdewolff/minify/v2/json"
+	minifyxml "github.com/tdewolff/minify/v2/xml"
 	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
 	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"golang.org/x/net/html"
+	"golang.org/x/text/unicode/norm"
+	"gopkg.in/yaml.v3"
 )
 
-// Configuration
+// Configuration, filled in from site.yaml by applySiteConfig
 var (
+	site            SiteConfig
 	contentDir      = "content"
 	postsDir        = filepath.Join(contentDir, "posts")
 	imagesDir       = filepath.Join(contentDir, "images")
 	outputDir       = "public"
 	templatesDir    = "templates"
 	staticDir       = "static"
+	themeDir        = ""
+	pagesDir        = filepath.Join(contentDir, "pages")
+	dataDir         = filepath.Join(contentDir, "data")
+	publicImagesDir = filepath.Join(outputDir, "images")
+	imageCacheDir   = filepath.Join(".cache", "images")
+	basePath        = "/"
+	slugMode        = "ascii"
+)
+
+// SiteConfig is site.yaml. Templates see it as .Site.
+type SiteConfig struct {
+	Title       string `yaml:"title"`
+	Author      string `yaml:"author"`
+	Description string `yaml:"description"`
+	// BaseURL is the scheme and host, e.g. https://thisiskarthik.com
+	BaseURL string `yaml:"base_url"`
+	// BasePath is the path the site is served under, "/" or "/repo-name/"
+	BasePath       string `yaml:"base_path"`
+	Language       string `yaml:"language"`
+	GitHubUsername string `yaml:"github_username"`
+	SlugMode       string `yaml:"slug_mode"`
+	// Theme names a directory under themes/ whose templates/ and static/
+	// sit below the project's own; empty means no theme
+	Theme string `yaml:"theme"`
+
+	Feed struct {
+		Limit    int    `yaml:"limit"`
+		Language string `yaml:"language"`
+	} `yaml:"feed"`
+
+	// Highlight names the Chroma styles for code blocks, one for each
+	// color scheme; css/syntax.css is generated from them
+	Highlight struct {
+		Light string `yaml:"light"`
+		Dark  string `yaml:"dark"`
+	} `yaml:"highlight"`
+
+	// Assets.Fingerprint writes static files as name.<hash>.ext so a deploy
+	// never leaves browsers on a stale copy; KeepOriginals also writes them
+	// under their plain names, for links from outside the site
+	Assets struct {
+		Fingerprint   bool `yaml:"fingerprint"`
+		KeepOriginals bool `yaml:"keep_originals"`
+	} `yaml:"assets"`
+
+	// Images.Widths are the narrower copies made of each content image for
+	// srcset. Sizes is the sizes attribute that goes with them, LayoutSizes
+	// replaces it for layouts that show images at another width
+	Images struct {
+		Widths      []int             `yaml:"widths"`
+		Sizes       string            `yaml:"sizes"`
+		LayoutSizes map[string]string `yaml:"layout_sizes"`
+		Quality     int               `yaml:"quality"`
+	} `yaml:"images"`
+
+	// TOC.MinHeadings is how many headings a post needs before it gets a
+	// table of contents without asking for one
+	TOC struct {
+		MinHeadings int `yaml:"min_headings"`
+	} `yaml:"toc"`
+
+	Dirs struct {
+		Content   string `yaml:"content"`
+		Output    string `yaml:"output"`
+		Templates string `yaml:"templates"`
+		Static    string `yaml:"static"`
+		Cache     string `yaml:"cache"`
+	} `yaml:"dirs"`
+}
+
+// defaultSiteConfig is used for anything site.yaml leaves out
+func defaultSiteConfig() SiteConfig {
+	var cfg SiteConfig
+	cfg.Title = "Theriyala, But Moving"
+	cfg.Author = "Karthik"
+	cfg.BaseURL = "https://thisiskarthik.com"
+	cfg.BasePath = "/"
+	cfg.Language = "en"
+	cfg.GitHubUsername = "karthi209"
+	cfg.SlugMode = "ascii"
+	cfg.Feed.Limit = 20
+	cfg.Feed.Language = "en-us"
+	cfg.TOC.MinHeadings = 3
+	cfg.Assets.Fingerprint = true
+	cfg.Images.Widths = []int{480, 800, 1200}
+	cfg.Images.Sizes = "(max-width: 720px) 100vw, 720px"
+	cfg.Images.LayoutSizes = map[string]string{"photo-essay": "min(calc(100vw - 2em), 1080px)"}
+	cfg.Images.Quality = 80
+	cfg.Highlight.Light = "github"
+	cfg.Highlight.Dark = "github-dark"
+	cfg.Dirs.Content = "content"
+	cfg.Dirs.Output = "public"
+	cfg.Dirs.Templates = "templates"
+	cfg.Dirs.Static = "static"
+	cfg.Dirs.Cache = ".cache"
+	return cfg
+}
+
+// loadSiteConfig reads the config file (site.yaml, or SITE_CONFIG) over the
+// defaults, then applies environment overrides for CI:
+// BASE_PATH, SITE_URL, GITHUB_USERNAME and SLUG_MODE.
+func loadSiteConfig() (SiteConfig, error) {
+	cfg := defaultSiteConfig()
+
+	configPath := os.Getenv("SITE_CONFIG")
+	if configPath == "" {
+		configPath = "site.yaml"
+	}
+	content, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return cfg, fmt.Errorf("difficulty in reading %s: %w", configPath, err)
+	}
+	if err == nil {
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && err != io.EOF {
+			return cfg, yamlError(configPath, 1, "config", err)
+		}
+	}
+
+	if username := os.Getenv("GITHUB_USERNAME"); username != "" {
+		cfg.GitHubUsername = username
+	}
+	if path := os.Getenv("BASE_PATH"); path != "" {
+		cfg.BasePath = path
+		// A project-site build lives on github.io unless SITE_URL says otherwise
+		if normalizeBasePath(path) != "/" {
+			cfg.BaseURL = fmt.Sprintf("https://%s.github.io", cfg.GitHubUsername)
+		}
+	}
+	if siteURL := os.Getenv("SITE_URL"); siteURL != "" {
+		cfg.BaseURL = siteURL
+	}
+	if mode := os.Getenv("SLUG_MODE"); mode != "" {
+		cfg.SlugMode = mode
+	}
+
+	cfg.BasePath = normalizeBasePath(cfg.BasePath)
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	cfg.SlugMode = strings.ToLower(cfg.SlugMode)
+	if cfg.SlugMode != "ascii" && cfg.SlugMode != "unicode" {
+		return cfg, fmt.Errorf("%s: slug_mode must be ascii or unicode, not %q", configPath, cfg.SlugMode)
+	}
+	if cfg.Feed.Limit < 1 {
+		return cfg, fmt.Errorf("%s: feed.limit must be at least 1", configPath)
+	}
+	for _, style := range []string{cfg.Highlight.Light, cfg.Highlight.Dark} {
+		if _, ok := styles.Registry[style]; !ok {
+			return cfg, fmt.Errorf("%s: highlight style %q is not a Chroma style", configPath, style)
+		}
+	}
+	if cfg.TOC.MinHeadings < 1 {
+		return cfg, fmt.Errorf("%s: toc.min_headings must be at least 1", configPath)
+	}
+	for _, width := range cfg.Images.Widths {
+		if width < 1 {
+			return cfg, fmt.Errorf("%s: images.widths must be positive, not %d", configPath, width)
+		}
+	}
+	sort.Ints(cfg.Images.Widths)
+	if cfg.Images.Quality < 1 || cfg.Images.Quality > 100 {
+		return cfg, fmt.Errorf("%s: images.quality must be between 1 and 100", configPath)
+	}
+	if strings.ContainsAny(cfg.Theme, "/\\") || cfg.Theme == "." || cfg.Theme == ".." {
+		return cfg, fmt.Errorf("%s: theme must be a directory name under themes/, not %q", configPath, cfg.Theme)
+	}
+	return cfg, nil
+}
+
+// applySiteConfig sets the package configuration from cfg
+func applySiteConfig(cfg SiteConfig) {
+	site = cfg
+	contentDir = cfg.Dirs.Content
+	postsDir = filepath.Join(contentDir, "posts")
+	imagesDir = filepath.Join(contentDir, "images")
+	pagesDir = filepath.Join(contentDir, "pages")
+	dataDir = filepath.Join(contentDir, "data")
+	outputDir = cfg.Dirs.Output
 	publicImagesDir = filepath.Join(outputDir, "images")
-	basePath        = getBasePath()
+	imageCacheDir = filepath.Join(cfg.Dirs.Cache, "images")
+	templatesDir = cfg.Dirs.Templates
+	staticDir = cfg.Dirs.Static
+	themeDir = ""
+	if cfg.Theme != "" {
+		themeDir = filepath.Join("themes", cfg.Theme)
+	}
+	basePath = cfg.BasePath
+	slugMode = cfg.SlugMode
+}
+
+// siteMenu is the footer menu built from content/pages
+var siteMenu []MenuItem
+
+// siteData holds the files from content/data, keyed by file name
+var siteData map[string]interface{}
+
+// Build flags
+var (
+	buildFuture = flag.Bool("build-future", false, "include posts whose publish_at is in the future")
+	buildDrafts = flag.Bool("drafts", false, "include draft posts (dev server preview; never in RSS)")
+	htmlMode    = flag.String("html", "pretty", "HTML output: pretty, minified or off")
+	minifyBuild = flag.Bool("minify", false, "minify HTML, CSS, inline scripts and RSS (deploys)")
 )
 
-// getBasePath returns the base path for assets and links
-// Reads from BASE_PATH environment variable, defaults to "/"
+// normalizeBasePath makes sure the base path starts and ends with /.
 // For GitHub Pages project sites, set BASE_PATH="/repo-name/"
-func getBasePath() string {
-	path := os.Getenv("BASE_PATH")
+func normalizeBasePath(path string) string {
 	if path == "" {
 		return "/"
 	}
@@ -52,23 +289,86 @@ func getBasePath() string {
 
 // Post represents a writing
 type Post struct {
-	ID        string `json:"id"`
-	Title     string `json:"title"`
-	Content   string `json:"content"`
-	Category  string `json:"category"`
-	Slug      string `json:"slug"`
-	IsDraft   bool   `json:"is_draft"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
+	ID       string   `json:"id"`
+	Title    string   `json:"title"`
+	Content  string   `json:"content"`
+	Category string   `json:"category"`
+	Tags     []string `json:"tags"`
+
+	// Layout is the template name without .html, default "post"
+	Layout string `json:"layout"`
+
+	// Aliases are old slugs that redirect to this post
+	Aliases []string `json:"aliases"`
+
+	// Series groups multi-part posts, ordered by SeriesOrder
+	Series      string `json:"series"`
+	SeriesOrder int    `json:"series_order"`
+	Slug        string `json:"slug"`
+	IsDraft     bool   `json:"is_draft"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+
+	// PublishAt and ExpireAt bound when the post is visible (RFC3339, or empty)
+	PublishAt string `json:"publish_at"`
+	ExpireAt  string `json:"expire_at"`
+
+	// SourcePath is the markdown file the post was read from
+	SourcePath string `json:"source_path"`
+
+	// BundleDir is set for page bundles (a directory with index.md); Assets
+	// are the files it references, relative to BundleDir
+	BundleDir string   `json:"bundle_dir"`
+	Assets    []string `json:"assets"`
+
+	// ImageVariants maps the output path of each resized image the post
+	// links to onto its file in the image cache
+	ImageVariants map[string]string `json:"-"`
+
+	// CoverImage is a site path under /images/, without basePath
+	CoverImage string `json:"cover_image"`
+	Edition    string `json:"edition"`
+
+	// TOC lists the post's headings, empty when the post doesn't get one
+	TOC []TOCEntry `json:"toc"`
+
+	Params map[string]interface{} `json:"params"`
+}
+
+// TOCEntry is one heading in a post's table of contents
+type TOCEntry struct {
+	Level int    `json:"level"`
+	ID    string `json:"id"`
+	Text  string `json:"text"`
 }
 
 // Frontmatter represents the YAML frontmatter in markdown files
 type Frontmatter struct {
-	Title    string
-	Category string
-	Date     string
-	Slug     string
-	IsDraft  bool
+	Title    string   `yaml:"title"`
+	Category string   `yaml:"category"`
+	Tags     []string `yaml:"tags"`
+
+	Series      string   `yaml:"series"`
+	SeriesOrder int      `yaml:"series_order"`
+	Aliases     []string `yaml:"aliases"`
+	Layout      string   `yaml:"layout"`
+	Date        string   `yaml:"date"`
+	Slug        string   `yaml:"slug"`
+	Updated     string   `yaml:"updated"`
+	IsDraft     bool     `yaml:"draft"`
+
+	PublishAt string `yaml:"publish_at"`
+	ExpireAt  string `yaml:"expire_at"`
+
+	CoverImage string `yaml:"cover_image"`
+	Edition    string `yaml:"edition"`
+
+	// TOC forces the table of contents on or off; unset leaves it to
+	// toc.min_headings in site.yaml
+	TOC *bool `yaml:"toc"`
+
+	// Params holds any keys not listed above, for templates to read
+	Params map[string]interface{} `yaml:",inline"`
 }
 
 // Template data structures
@@ -76,6 +376,9 @@ type HomePageData struct {
 	PageType        string
 	Title           string
 	BasePath        string
+	Site            SiteConfig
+	Data            map[string]interface{}
+	Menu            []MenuItem
 	Writings        []PostTemplateData
 	GroupedWritings []YearGroup
 }
@@ -84,10 +387,69 @@ type WritingsPageData struct {
 	PageType        string
 	Title           string
 	BasePath        string
+	Site            SiteConfig
+	Data            map[string]interface{}
+	Menu            []MenuItem
+	Writings        []PostTemplateData
+	GroupedWritings []YearGroup
+}
+
+type CategoryPageData struct {
+	PageType        string
+	Title           string
+	BasePath        string
+	Site            SiteConfig
+	Data            map[string]interface{}
+	Menu            []MenuItem
+	Category        string
+	CategoryUpper   string
+	Writings        []PostTemplateData
+	GroupedWritings []YearGroup
+}
+
+type CategoriesPageData struct {
+	PageType   string
+	Title      string
+	BasePath   string
+	Site       SiteConfig
+	Data       map[string]interface{}
+	Menu       []MenuItem
+	Categories []CategoryCount
+}
+
+type CategoryCount struct {
+	Name  string
+	Upper string
+	Count int
+}
+
+type TagPageData struct {
+	PageType        string
+	Title           string
+	BasePath        string
+	Site            SiteConfig
+	Data            map[string]interface{}
+	Menu            []MenuItem
+	Tag             string
 	Writings        []PostTemplateData
 	GroupedWritings []YearGroup
 }
 
+type TagsPageData struct {
+	PageType string
+	Title    string
+	BasePath string
+	Site     SiteConfig
+	Data     map[string]interface{}
+	Menu     []MenuItem
+	Tags     []TagCount
+}
+
+type TagCount struct {
+	Name  string
+	Count int
+}
+
 type YearGroup struct {
 	Year  string
 	Count int
@@ -102,34 +464,106 @@ type PostTemplateData struct {
 	Year            int
 	Category        string
 	CategoryUpper   string
+	Tags            []string
+	Series          string
+	SeriesSlug      string
+	SeriesOrder     int
+	Aliases         []string
+	Layout          string
 	Content         template.HTML
 	ReadingTime     int
 	IsDraft         bool
+	IsScheduled     bool
 	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	UpdatedLabel    string // formal date, empty unless updated on a later day
+	CoverImage      string // URL including basePath
+	Edition         string
+	TOC             []TOCEntry
+	Params          map[string]interface{}
 }
 
 type PostPageData struct {
 	PageType string
 	Title    string
 	BasePath string
+	Site     SiteConfig
+	Data     map[string]interface{}
+	Menu     []MenuItem
 	Post     PostTemplateData
+
+	// Series navigation, empty unless the post is part of a series
+	Series      string
+	SeriesSlug  string
+	SeriesPosts []PostTemplateData
+	SeriesPrev  *PostTemplateData
+	SeriesNext  *PostTemplateData
 }
 
-type AboutPageData struct {
-	PageType string
-	Title    string
-	BasePath string
+type AliasPageData struct {
+	PageType     string
+	Title        string
+	BasePath     string
+	Site         SiteConfig
+	Data         map[string]interface{}
+	Target       string // path of the post, including basePath
+	CanonicalURL string
+}
+
+type SeriesPageData struct {
+	PageType   string
+	Title      string
+	BasePath   string
+	Site       SiteConfig
+	Data       map[string]interface{}
+	Menu       []MenuItem
+	Series     string
+	SeriesSlug string
+	Posts      []PostTemplateData
+}
+
+// Page is a standalone page from content/pages
+type Page struct {
+	Title       string
+	Description string
+	Path        string // site path without slashes, e.g. "about"
+	Layout      string
+	Menu        int
+	Content     template.HTML
+	Params      map[string]interface{}
+	SourcePath  string
+	// ImageVariants are the resized images the page links to, as on Post
+	ImageVariants map[string]string
+}
+
+// PageFrontmatter is the frontmatter of a standalone page
+type PageFrontmatter struct {
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	Layout      string `yaml:"layout"` // template name without .html, default "page"
+	Menu        int    `yaml:"menu"`   // position in the footer menu, 0 to leave out
+
+	Params map[string]interface{} `yaml:",inline"`
 }
 
-type MetaPageData struct {
+type MenuItem struct {
+	Title string
+	Path  string
+	Order int
+}
+
+type StandalonePageData struct {
 	PageType  string
 	Title     string
 	BasePath  string
+	Site      SiteConfig
+	Data      map[string]interface{}
+	Menu      []MenuItem
+	Page      Page
 	BuildYear int
 	BuildTime string
 }
 
-
 // plural returns "s" if count is not 1, empty string otherwise
 func plural(count int) string {
 	if count == 1 {
@@ -138,19 +572,393 @@ func plural(count int) string {
 	return "s"
 }
 
-// validateDirectories checks that required directories exist
+// allowedCategories is the fixed list of categories a post can be filed under
+var allowedCategories = []string{"tech", "life", "music", "games", "movies", "tv", "books"}
+
+func isAllowedCategory(category string) bool {
+	for _, allowed := range allowedCategories {
+		if category == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeTags lowercases and slugifies tag names so "Linux" and "linux"
+// become one tag, dropping empties and duplicates
+func normalizeTags(tags []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = generateSlug(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// parseTimestamp parses a publish_at/expire_at value. Dates without a zone
+// are taken as local time; an empty value gives the zero time.
+func parseTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a date or timestamp", value)
+}
+
+// formatTimestamp formats t as RFC3339, or "" for the zero time
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// isFuture reports whether the post's publish_at is still ahead of now
+func isFuture(post Post, now time.Time) bool {
+	publishAt, _ := time.Parse(time.RFC3339, post.PublishAt)
+	return !publishAt.IsZero() && publishAt.After(now)
+}
+
+// isPublished reports whether the post is inside its publish_at/expire_at
+// window. Future posts count as published with --build-future.
+func isPublished(post Post, now time.Time) bool {
+	if isFuture(post, now) && !*buildFuture {
+		return false
+	}
+	expireAt, _ := time.Parse(time.RFC3339, post.ExpireAt)
+	if !expireAt.IsZero() && !expireAt.After(now) {
+		return false
+	}
+	return true
+}
+
+// gitHistory is cleared in a shallow clone, whose log only reaches back a
+// few commits, so every post would look created and updated by the last one
+var gitHistory = true
+
+// isShallowClone reports whether the working tree is a shallow git clone
+func isShallowClone() bool {
+	out, err := exec.Command("git", "rev-parse", "--is-shallow-repository").Output()
+	return err == nil && strings.TrimSpace(string(out)) == "true"
+}
+
+// gitDates returns the author dates of the first and last commits touching
+// filePath, following renames. Both are zero when git is unavailable, the
+// clone is shallow or the file has never been committed.
+func gitDates(filePath string) (first, last time.Time) {
+	if !gitHistory {
+		return time.Time{}, time.Time{}
+	}
+	out, err := exec.Command("git", "log", "--follow", "--format=%aI", "--", filePath).Output()
+	if err != nil {
+		return time.Time{}, time.Time{}
+	}
+	lines := strings.Fields(string(out))
+	if len(lines) == 0 {
+		return time.Time{}, time.Time{}
+	}
+	// git log lists newest first
+	last, _ = time.Parse(time.RFC3339, lines[0])
+	first, _ = time.Parse(time.RFC3339, lines[len(lines)-1])
+	return first, last
+}
+
+// fallbackDate is used when a post has no usable date: the first commit if
+// there is one, otherwise the file's mtime
+func fallbackDate(filePath string, firstCommit time.Time) time.Time {
+	if !firstCommit.IsZero() {
+		return firstCommit
+	}
+	if info, err := os.Stat(filePath); err == nil {
+		return info.ModTime()
+	}
+	return time.Now()
+}
+
+// checkSeries reports series with missing, duplicate or non-consecutive
+// series_order values. Orders must run 1, 2, 3... across all posts in the
+// series, drafts included.
+func checkSeries(posts []Post) []error {
+	var errs []error
+	bySeries := make(map[string][]Post)
+	var names []string
+	for _, post := range posts {
+		if post.Series == "" {
+			continue
+		}
+		if post.SeriesOrder < 1 {
+			errs = append(errs, fmt.Errorf("%s: series %q needs a series_order of 1 or more", post.SourcePath, post.Series))
+			continue
+		}
+		key := generateSlug(post.Series)
+		if _, ok := bySeries[key]; !ok {
+			names = append(names, key)
+		}
+		bySeries[key] = append(bySeries[key], post)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		seriesPosts := bySeries[name]
+		sort.SliceStable(seriesPosts, func(i, j int) bool {
+			return seriesPosts[i].SeriesOrder < seriesPosts[j].SeriesOrder
+		})
+		for i, post := range seriesPosts {
+			if i > 0 && post.SeriesOrder == seriesPosts[i-1].SeriesOrder {
+				errs = append(errs, fmt.Errorf("series %q: series_order %d used by both %s and %s",
+					post.Series, post.SeriesOrder, seriesPosts[i-1].SourcePath, post.SourcePath))
+				continue
+			}
+			expected := 1
+			if i > 0 {
+				expected = seriesPosts[i-1].SeriesOrder + 1
+			}
+			if post.SeriesOrder != expected {
+				errs = append(errs, fmt.Errorf("series %q: gap before series_order %d (%s), expected %d",
+					post.Series, post.SeriesOrder, post.SourcePath, expected))
+			}
+		}
+	}
+	return errs
+}
+
+// normalizeAliases accepts old slugs as "old-slug" or "/writings/old-slug/"
+// and returns the bare slugs
+func normalizeAliases(aliases []string) []string {
+	var result []string
+	for _, alias := range aliases {
+		alias = strings.Trim(strings.TrimSpace(alias), "/")
+		alias = strings.TrimPrefix(alias, "writings/")
+		if alias != "" {
+			result = append(result, alias)
+		}
+	}
+	return result
+}
+
+// checkAliases reports aliases that would overwrite a post's page or
+// another alias
+func checkAliases(posts []Post) []error {
+	var errs []error
+	owners := make(map[string]string)
+	for slug, owner := range reservedSlugs {
+		owners[slug] = owner
+	}
+	for _, post := range posts {
+		owners[post.Slug] = post.SourcePath
+	}
+	for _, post := range posts {
+		for _, alias := range post.Aliases {
+			if strings.ContainsAny(alias, "/\\") || alias == "." || alias == ".." {
+				errs = append(errs, fmt.Errorf("%s: alias %q must be a single slug", post.SourcePath, alias))
+				continue
+			}
+			if owner, ok := owners[alias]; ok {
+				errs = append(errs, fmt.Errorf("alias %q in %s collides with %s", alias, post.SourcePath, owner))
+				continue
+			}
+			owners[alias] = post.SourcePath
+		}
+	}
+	return errs
+}
+
+// nonPostLayouts are templates rendered with other data than a post's:
+// the generator's own listing pages and the standalone page layouts
+var nonPostLayouts = map[string]string{
+	"home":       "the home page",
+	"writings":   "the writings index",
+	"category":   "category pages",
+	"categories": "the category index",
+	"tag":        "tag pages",
+	"tags":       "the tag index",
+	"series":     "series pages",
+	"alias":      "alias redirects",
+	"page":       "standalone pages",
+	"meta":       "standalone pages",
+}
+
+// checkLayouts reports posts whose layout has no template in templates/ or
+// is not a post layout
+func checkLayouts(templates Templates, posts []Post) []error {
+	var errs []error
+	for _, post := range posts {
+		if usedBy, ok := nonPostLayouts[post.Layout]; ok {
+			errs = append(errs, fmt.Errorf("%s: layout %q is for %s, not posts; use post, note, photo-essay or a post layout of your own", post.SourcePath, post.Layout, usedBy))
+			continue
+		}
+		if strings.ContainsAny(post.Layout, "/\\") || templates.Lookup(post.Layout+".html") == nil {
+			errs = append(errs, fmt.Errorf("%s: layout %q not found in %s", post.SourcePath, post.Layout, strings.Join(templateDirs(), " or ")))
+		}
+	}
+	return errs
+}
+
+// checkPageLayouts reports pages whose layout has no template in templates/
+func checkPageLayouts(templates Templates, pages []Page) []error {
+	var errs []error
+	for _, page := range pages {
+		if strings.ContainsAny(page.Layout, "/\\") || templates.Lookup(page.Layout+".html") == nil {
+			errs = append(errs, fmt.Errorf("%s: layout %q not found in %s", page.SourcePath, page.Layout, strings.Join(templateDirs(), " or ")))
+		}
+	}
+	return errs
+}
+
+// reservedSlugs are directories under writings/ that the generator writes
+// itself, so neither a post nor an alias may use them
+var reservedSlugs = map[string]string{
+	"category": "the category archive",
+}
+
+// checkSlugCollisions reports posts that would write to the same
+// writings/{slug}/ directory
+func checkSlugCollisions(posts []Post) []error {
+	var errs []error
+	seen := make(map[string]string)
+	for _, post := range posts {
+		if owner, ok := reservedSlugs[post.Slug]; ok {
+			errs = append(errs, fmt.Errorf("%s: slug %q is taken by %s", post.SourcePath, post.Slug, owner))
+			continue
+		}
+		if other, ok := seen[post.Slug]; ok {
+			errs = append(errs, fmt.Errorf("slug %q used by both %s and %s", post.Slug, other, post.SourcePath))
+			continue
+		}
+		seen[post.Slug] = post.SourcePath
+	}
+	return errs
+}
+
+// clearOutputDir removes the output directory, refusing when it would take
+// the project or its sources with it
+func clearOutputDir() error {
+	output, err := filepath.Abs(outputDir)
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{".", contentDir, templatesDir, staticDir} {
+		source, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if source == output || strings.HasPrefix(source, output+string(filepath.Separator)) {
+			return fmt.Errorf("output directory %s contains %s; refusing to clear it", outputDir, dir)
+		}
+	}
+	return os.RemoveAll(outputDir)
+}
+
+// validateDirectories checks that required directories exist. With a
+// theme, the theme can provide templates/ and static/ on its own
 func validateDirectories() error {
-	if _, err := os.Stat(templatesDir); os.IsNotExist(err) {
+	if themeDir != "" {
+		if _, err := os.Stat(themeDir); os.IsNotExist(err) {
+			return fmt.Errorf("theme not found: %s", themeDir)
+		}
+	}
+	if len(existingDirs(templateDirs())) == 0 {
 		return fmt.Errorf("templates directory not found: %s", templatesDir)
 	}
-	if _, err := os.Stat(staticDir); os.IsNotExist(err) {
+	if len(existingDirs(staticDirs())) == 0 {
 		return fmt.Errorf("static directory not found: %s", staticDir)
 	}
 	return nil
 }
 
+// templateDirs returns the template directories in lookup order: the
+// theme's first, then the project's, which overrides it file by file
+func templateDirs() []string {
+	return layerDirs("templates", templatesDir)
+}
+
+// staticDirs returns the static directories in the same order
+func staticDirs() []string {
+	return layerDirs("static", staticDir)
+}
+
+func layerDirs(themeSubdir, projectDir string) []string {
+	var dirs []string
+	if themeDir != "" {
+		dirs = append(dirs, filepath.Join(themeDir, themeSubdir))
+	}
+	return append(dirs, projectDir)
+}
+
+// existingDirs filters out directories that don't exist
+func existingDirs(dirs []string) []string {
+	var existing []string
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			existing = append(existing, dir)
+		}
+	}
+	return existing
+}
+
+// layeredGlob matches pattern in each directory in turn and returns the
+// files keyed by name relative to their directory; a file in a later
+// directory replaces the same name from an earlier one
+func layeredGlob(dirs []string, pattern string) (map[string]string, error) {
+	files := map[string]string{}
+	for _, dir := range dirs {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			name, err := filepath.Rel(dir, match)
+			if err != nil {
+				return nil, err
+			}
+			files[filepath.ToSlash(name)] = match
+		}
+	}
+	return files, nil
+}
+
+// sortedKeys returns the keys of a layeredGlob result in order
+func sortedKeys(files map[string]string) []string {
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func main() {
+	flag.Parse()
 	buildStart := time.Now()
+
+	if *htmlMode != "pretty" && *htmlMode != "minified" && *htmlMode != "off" {
+		fmt.Printf("▓▓ ERROR: --html must be pretty, minified or off, not %q\n", *htmlMode)
+		os.Exit(1)
+	}
+	if *minifyBuild {
+		minifier = newMinifier()
+	}
+
+	cfg, err := loadSiteConfig()
+	if err != nil {
+		fmt.Printf("▓▓ ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	applySiteConfig(cfg)
+
 	fmt.Println("▓▓ SITE GENERATOR V1.0")
 	fmt.Println("▓▓ INITIALIZING...")
 	fmt.Println()
@@ -161,7 +969,12 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Ensure output directory exists and is writable
+	// Start from an empty output directory, so drafts, scheduled and expired
+	// posts or renamed files from an earlier build are never deployed
+	if err := clearOutputDir(); err != nil {
+		fmt.Printf("▓▓ ERROR: cannot prepare workspace: %v\n", err)
+		os.Exit(1)
+	}
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		fmt.Printf("▓▓ ERROR: cannot prepare workspace: %v\n", err)
 		os.Exit(1)
@@ -174,6 +987,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	if isShallowClone() {
+		gitHistory = false
+		fmt.Println("▓▓ WARNING: shallow clone, post dates come from frontmatter only")
+	}
+
 	// Find all markdown files
 	markdownFiles, err := findMarkdownFiles(postsDir)
 	if err != nil {
@@ -198,17 +1016,50 @@ func main() {
 		fmt.Printf("▓▓ LOADING %d POST%s...\n", len(postFiles), strings.ToUpper(plural(len(postFiles))))
 	}
 
-	// Process all posts
+	// Process all posts; a broken post fails the build rather than vanishing
 	var posts []Post
+	var postErrors []error
 	for _, filePath := range postFiles {
 		post, err := processPostFile(filePath)
 		if err != nil {
-			continue // Silently skip invalid files
+			if !strings.HasPrefix(err.Error(), filePath) {
+				err = fmt.Errorf("%s: %w", filePath, err)
+			}
+			postErrors = append(postErrors, err)
+			continue
 		}
 		if post != nil && post.Title != "" {
 			posts = append(posts, *post)
 		}
 	}
+	postErrors = append(postErrors, checkSlugCollisions(posts)...)
+	postErrors = append(postErrors, checkSeries(posts)...)
+	postErrors = append(postErrors, checkAliases(posts)...)
+	postErrors = append(postErrors, checkLayouts(templates, posts)...)
+	if len(postErrors) > 0 {
+		for _, err := range postErrors {
+			fmt.Printf("▓▓ ERROR: %v\n", err)
+		}
+		os.Exit(1)
+	}
+
+	// Data files, loaded once and shared by every template
+	siteData, err = loadData(dataDir)
+	if err != nil {
+		fmt.Printf("▓▓ ERROR: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Standalone pages, which also make up the footer menu
+	pages, pageErrors := loadPages()
+	pageErrors = append(pageErrors, checkPageLayouts(templates, pages)...)
+	if len(pageErrors) > 0 {
+		for _, err := range pageErrors {
+			fmt.Printf("▓▓ ERROR: %v\n", err)
+		}
+		os.Exit(1)
+	}
+	siteMenu = buildMenu(pages)
 
 	// Sort by created_at descending (newest first)
 	sort.Slice(posts, func(i, j int) bool {
@@ -222,12 +1073,37 @@ func main() {
 	}
 
 	// Convert posts to template data
+	now := time.Now()
+	var scheduled int
+	var bundles []Post
+	// Only published posts and the pages get their resized images written
+	imageVariants := make(map[string]string)
+	for _, page := range pages {
+		for destPath, cached := range page.ImageVariants {
+			imageVariants[destPath] = cached
+		}
+	}
 	postTemplateData := make([]PostTemplateData, 0, len(posts))
 	for _, post := range posts {
-		if post.IsDraft {
+		if post.IsDraft && !*buildDrafts {
 			continue // Skip drafts in static site
 		}
+		if !isPublished(post, now) {
+			scheduled++
+			continue
+		}
+		if len(post.Assets) > 0 {
+			bundles = append(bundles, post)
+		}
+		for destPath, cached := range post.ImageVariants {
+			imageVariants[destPath] = cached
+		}
 		createdAt, _ := time.Parse(time.RFC3339, post.CreatedAt)
+		updatedAt, _ := time.Parse(time.RFC3339, post.UpdatedAt)
+		var updatedLabel string
+		if updatedAt.Format("2006-01-02") > createdAt.Format("2006-01-02") {
+			updatedLabel = formatDateFormal(post.UpdatedAt)
+		}
 		dateLabel := formatDate(post.CreatedAt)
 		dateLabelFormal := formatDateFormal(post.CreatedAt)
 		readingTime := calculateReadingTime(post.Content)
@@ -239,16 +1115,45 @@ func main() {
 			Year:            createdAt.Year(),
 			Category:        post.Category,
 			CategoryUpper:   strings.ToUpper(post.Category),
+			Tags:            post.Tags,
+			Series:          post.Series,
+			SeriesSlug:      generateSlug(post.Series),
+			SeriesOrder:     post.SeriesOrder,
+			Aliases:         post.Aliases,
+			Layout:          post.Layout,
 			Content:         template.HTML(post.Content),
 			ReadingTime:     readingTime,
 			IsDraft:         post.IsDraft,
+			IsScheduled:     isFuture(post, now),
 			CreatedAt:       createdAt,
+			UpdatedAt:       updatedAt,
+			UpdatedLabel:    updatedLabel,
+			CoverImage:      coverImageURL(post.CoverImage),
+			Edition:         post.Edition,
+			TOC:             post.TOC,
+			Params:          post.Params,
 		})
 	}
 
+	if scheduled > 0 {
+		fmt.Printf("▓▓ HELD BACK %d SCHEDULED OR EXPIRED POST%s\n", scheduled, strings.ToUpper(plural(scheduled)))
+	}
+
 	// Group posts by year
 	groupedWritings := groupPostsByYear(postTemplateData)
 
+	// Copy static files first, so templates can resolve fingerprinted names
+	fmt.Println("▓▓ COPYING ASSETS...")
+	if err := copyStaticFiles(); err != nil {
+		fmt.Printf("▓▓ WARNING: asset copy failed: %v\n", err)
+	}
+	if err := writeSyntaxCSS(); err != nil {
+		fmt.Printf("▓▓ WARNING: syntax stylesheet failed: %v\n", err)
+	}
+	if err := writeAssetManifest(); err != nil {
+		fmt.Printf("▓▓ WARNING: asset manifest failed: %v\n", err)
+	}
+
 	// Generate pages
 	fmt.Println("▓▓ GENERATING PAGES...")
 	if err := generateHomePage(templates, postTemplateData, groupedWritings); err != nil {
@@ -259,38 +1164,57 @@ func main() {
 		fmt.Printf("▓▓ ERROR: writings page failed: %v\n", err)
 	}
 
+	series := groupPostsBySeries(postTemplateData)
+	var pageFailed bool
 	for _, post := range postTemplateData {
-		if err := generatePostPage(templates, post); err != nil {
-			continue // Skip failed pages silently
+		if err := generatePostPage(templates, post, series[post.SeriesSlug]); err != nil {
+			fmt.Printf("▓▓ ERROR: post %s failed: %v\n", post.Slug, err)
+			pageFailed = true
 		}
 	}
+	if pageFailed {
+		os.Exit(1)
+	}
 
-	if err := generateAboutPage(templates); err != nil {
-		fmt.Printf("▓▓ ERROR: about page failed: %v\n", err)
+	if err := generateAliasPages(templates, postTemplateData); err != nil {
+		fmt.Printf("▓▓ ERROR: alias pages failed: %v\n", err)
 	}
 
-	if err := generateForAIPage(templates); err != nil {
-		fmt.Printf("▓▓ ERROR: forai page failed: %v\n", err)
+	if err := generateSeriesPages(templates, series); err != nil {
+		fmt.Printf("▓▓ ERROR: series pages failed: %v\n", err)
 	}
 
 	buildDuration := time.Since(buildStart)
-	if err := generateMetaPage(templates, buildDuration); err != nil {
-		fmt.Printf("▓▓ ERROR: meta page failed: %v\n", err)
+	if errs := generatePages(templates, pages, buildDuration); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Printf("▓▓ ERROR: page failed: %v\n", err)
+		}
+		os.Exit(1)
 	}
 
 	if err := generateRSSFeed(postTemplateData); err != nil {
 		fmt.Printf("▓▓ ERROR: RSS feed failed: %v\n", err)
 	}
 
-	// Copy static files
-	fmt.Println("▓▓ COPYING ASSETS...")
-	if err := copyStaticFiles(); err != nil {
-		fmt.Printf("▓▓ WARNING: asset copy failed: %v\n", err)
+	if err := generateCategoryPages(templates, postTemplateData); err != nil {
+		fmt.Printf("▓▓ ERROR: category pages failed: %v\n", err)
+	}
+
+	if err := generateTagPages(templates, postTemplateData); err != nil {
+		fmt.Printf("▓▓ ERROR: tag pages failed: %v\n", err)
 	}
 
 	// Copy images (non-critical, continue on error)
 	_ = copyImages()
 
+	if err := copyBundleAssets(bundles); err != nil {
+		fmt.Printf("▓▓ ERROR: bundle assets failed: %v\n", err)
+	}
+
+	if err := writeImageVariants(imageVariants); err != nil {
+		fmt.Printf("▓▓ ERROR: image variants failed: %v\n", err)
+	}
+
 	// Completion message
 	fmt.Println()
 	if len(postTemplateData) > 0 {
@@ -299,24 +1223,139 @@ func main() {
 		fmt.Printf("▓▓ BUILD COMPLETE → %s/\n", outputDir)
 	}
 	fmt.Printf("▓▓ TIME: %dms\n", buildDuration.Milliseconds())
+	for _, kind := range []string{"HTML", "CSS", "RSS"} {
+		if stats := minifyStats[kind]; stats != nil {
+			fmt.Printf("▓▓ MINIFIED %s: %s → %s (SAVED %s)\n", kind, formatBytes(stats.before), formatBytes(stats.after), formatBytes(stats.before-stats.after))
+		}
+	}
 	fmt.Println()
 }
 
-func loadTemplates() (*template.Template, error) {
-	tmpl := template.New("base")
+// minifier is set by --minify; while nil, output stays readable
+var minifier *minify.M
+
+// minifyStats counts bytes before and after minifying, per asset type
+var minifyStats = map[string]*struct{ before, after int }{}
+
+// newMinifier handles HTML (with its inline scripts, styles and JSON-LD),
+// CSS and XML. Document and end tags are kept so pages stay easy to read
+// back when debugging a deploy, and whitespace between inline elements is
+// kept because it renders
+func newMinifier() *minify.M {
+	m := minify.New()
+	m.Add("text/html", &minifyhtml.Minifier{
+		KeepDocumentTags: true,
+		KeepEndTags:      true,
+		KeepQuotes:       true,
+		KeepWhitespace:   true,
+	})
+	m.AddFunc("text/css", minifycss.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`^(application|text)/(x-)?(java|ecma)script$`), minifyjs.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`[/+]json$`), minifyjson.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`[/+]xml$`), minifyxml.Minify)
+	return m
+}
 
-	// Load all template files
-	files, err := filepath.Glob(filepath.Join(templatesDir, "*.html"))
+// minifyAsset minifies content of the given media type when --minify is
+// on, counting the savings under kind ("HTML", "CSS", "RSS")
+func minifyAsset(kind, mediaType string, content []byte) ([]byte, error) {
+	if minifier == nil {
+		return content, nil
+	}
+	minified, err := minifier.Bytes(mediaType, content)
+	if err != nil {
+		return nil, fmt.Errorf("could not minify %s: %w", kind, err)
+	}
+	stats := minifyStats[kind]
+	if stats == nil {
+		stats = &struct{ before, after int }{}
+		minifyStats[kind] = stats
+	}
+	stats.before += len(content)
+	stats.after += len(minified)
+	return minified, nil
+}
+
+// formatBytes gives a byte count in B or KB
+func formatBytes(n int) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f KB", float64(n)/1024)
+}
+
+// baseTemplate is the shared page skeleton. Page templates that only
+// define blocks ("title", "description", "head", "main") are rendered
+// through it; a page template with its own markup is rendered as is
+const baseTemplate = "base.html"
+
+// Templates holds one template set per page template. Each set is a clone
+// of the base layout and partials with that page parsed on top, so the
+// blocks one page overrides don't clobber another's
+type Templates map[string]*template.Template
+
+// Lookup returns the template set for a page template, or nil
+func (t Templates) Lookup(name string) *template.Template {
+	return t[name]
+}
+
+// Execute renders a page template, through the base layout if the page
+// only defines blocks
+func (t Templates) Execute(w io.Writer, name string, data interface{}) error {
+	set := t[name]
+	if set == nil {
+		return fmt.Errorf("template %s not found", name)
+	}
+	entry := name
+	if page := set.Lookup(name); page.Tree == nil || parse.IsEmptyTree(page.Tree.Root) {
+		entry = baseTemplate
+	}
+	return set.ExecuteTemplate(w, entry, data)
+}
+
+func loadTemplates() (Templates, error) {
+	shared := template.New("base").Funcs(templateFuncs())
+	dirs := templateDirs()
+
+	// The base layout is optional, templates can still be full pages.
+	// Partials are available to every page as {{template "partials/name.html" .}}
+	layouts, err := layeredGlob(dirs, baseTemplate)
 	if err != nil {
 		return nil, fmt.Errorf("difficulty in finding templates: %w", err)
 	}
+	partials, err := layeredGlob(dirs, filepath.Join("partials", "*.html"))
+	if err != nil {
+		return nil, fmt.Errorf("difficulty in finding partials: %w", err)
+	}
+	for name, file := range partials {
+		layouts[name] = file
+	}
+	for _, name := range sortedKeys(layouts) {
+		file := layouts[name]
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("difficulty in reading template %s: %w", file, err)
+		}
+		if _, err := shared.New(name).Parse(string(content)); err != nil {
+			return nil, fmt.Errorf("difficulty in parsing template %s: %w", file, err)
+		}
+	}
+
+	// Load all template files, project templates overriding the theme's
+	files, err := layeredGlob(dirs, "*.html")
+	if err != nil {
+		return nil, fmt.Errorf("difficulty in finding templates: %w", err)
+	}
+	delete(files, baseTemplate)
 
 	if len(files) == 0 {
-		return nil, fmt.Errorf("no template files found in %s", templatesDir)
+		return nil, fmt.Errorf("no template files found in %s", strings.Join(dirs, ", "))
 	}
 
-	// Parse all templates
-	for _, file := range files {
+	// Parse each page template into its own clone of the shared set
+	templates := Templates{}
+	for _, name := range sortedKeys(files) {
+		file := files[name]
 		content, err := os.ReadFile(file)
 		if err != nil {
 			return nil, fmt.Errorf("difficulty in reading template %s: %w", file, err)
@@ -324,20 +1363,131 @@ func loadTemplates() (*template.Template, error) {
 		if len(content) == 0 {
 			continue // Skip empty templates
 		}
-		_, err = tmpl.New(filepath.Base(file)).Parse(string(content))
+		set, err := shared.Clone()
 		if err != nil {
+			return nil, fmt.Errorf("difficulty in cloning templates for %s: %w", file, err)
+		}
+		if _, err := set.New(name).Parse(string(content)); err != nil {
 			return nil, fmt.Errorf("difficulty in parsing template %s: %w", file, err)
 		}
+		templates[name] = set
 	}
 
-	return tmpl, nil
+	return templates, nil
 }
 
-func generateHomePage(templates *template.Template, posts []PostTemplateData, grouped []YearGroup) error {
+// assetManifest maps logical static asset names (css/style.css) to the
+// names they are written under; assets missing from it keep their name
+var assetManifest = map[string]string{}
+
+// assetIntegrity holds the Subresource Integrity hash of each asset
+var assetIntegrity = map[string]string{}
+
+// templateFuncs is the function library available to every template
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// date formats a time.Time or RFC3339 string with a Go layout:
+		// {{date "Jan 2, 2006" .Post.CreatedAt}}
+		"date": func(layout string, value interface{}) string {
+			t, ok := toTime(value)
+			if !ok {
+				return "—"
+			}
+			return t.Format(layout)
+		},
+		// dateFormal gives "the 15th of May, 2025"
+		"dateFormal": func(value interface{}) string {
+			t, ok := toTime(value)
+			if !ok {
+				return "—"
+			}
+			return formatDateFormal(t.Format(time.RFC3339))
+		},
+		// relURL and absURL resolve a site path against basePath
+		"relURL": func(sitePath string) string {
+			return withBasePath(sitePath)
+		},
+		"absURL": func(sitePath string) string {
+			return getSiteURL() + withBasePath(sitePath)
+		},
+		// asset resolves a static file to its output name (e.g. fingerprinted)
+		"asset": func(name string) string {
+			name = strings.TrimPrefix(name, "/")
+			if mapped, ok := assetManifest[name]; ok {
+				name = mapped
+			}
+			return withBasePath(name)
+		},
+		// integrity gives the SRI hash of a static file, for
+		// <link href="{{asset "css/style.css"}}" integrity="{{integrity "css/style.css"}}">
+		"integrity": func(name string) string {
+			return assetIntegrity[strings.TrimPrefix(name, "/")]
+		},
+		// truncate shortens text to n characters, cutting at a word boundary
+		"truncate": truncateText,
+		// excerpt strips HTML and truncates: {{excerpt 160 .Post.Content}}
+		"excerpt": func(n int, content interface{}) string {
+			return truncateText(n, stripTags(fmt.Sprint(content)))
+		},
+		// markdownify renders inline markdown, without a wrapping <p>
+		"markdownify": func(text string) (template.HTML, error) {
+			var buf strings.Builder
+			if err := newMarkdown().Convert([]byte(text), &buf); err != nil {
+				return "", err
+			}
+			out := strings.TrimSpace(buf.String())
+			if strings.HasPrefix(out, "<p>") && strings.HasSuffix(out, "</p>") && strings.Count(out, "<p>") == 1 {
+				out = strings.TrimSuffix(strings.TrimPrefix(out, "<p>"), "</p>")
+			}
+			return template.HTML(out), nil
+		},
+		// pluralize gives "s" unless count is 1: post{{pluralize .Count}}
+		"pluralize": plural,
+		// jsonify encodes a value as JSON, e.g. for JSON-LD
+		"jsonify": func(value interface{}) (template.JS, error) {
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return "", err
+			}
+			return template.JS(encoded), nil
+		},
+	}
+}
+
+// toTime accepts a time.Time or an RFC3339 string
+func toTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, !v.IsZero()
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// truncateText shortens text to at most n characters, preferring to cut at
+// a space, and adds an ellipsis when it cut anything
+func truncateText(n int, text string) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= n {
+		return string(runes)
+	}
+	cut := string(runes[:n])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+func generateHomePage(templates Templates, posts []PostTemplateData, grouped []YearGroup) error {
 	data := HomePageData{
 		PageType:        "home",
 		Title:           "Home",
 		BasePath:        basePath,
+		Site:            site,
+		Data:            siteData,
+		Menu:            siteMenu,
 		Writings:        posts,
 		GroupedWritings: grouped,
 	}
@@ -345,11 +1495,14 @@ func generateHomePage(templates *template.Template, posts []PostTemplateData, gr
 	return writeTemplate(templates, "home.html", filepath.Join(outputDir, "index.html"), data)
 }
 
-func generateWritingsPage(templates *template.Template, posts []PostTemplateData, grouped []YearGroup) error {
+func generateWritingsPage(templates Templates, posts []PostTemplateData, grouped []YearGroup) error {
 	data := WritingsPageData{
 		PageType:        "writings",
 		Title:           "Writings",
 		BasePath:        basePath,
+		Site:            site,
+		Data:            siteData,
+		Menu:            siteMenu,
 		Writings:        posts,
 		GroupedWritings: grouped,
 	}
@@ -357,7 +1510,178 @@ func generateWritingsPage(templates *template.Template, posts []PostTemplateData
 	return writeTemplate(templates, "writings.html", filepath.Join(outputDir, "writings", "index.html"), data)
 }
 
-func generatePostPage(templates *template.Template, post PostTemplateData) error {
+// generateCategoryPages writes writings/category/index.html plus a page and
+// RSS feed for every category that has posts
+func generateCategoryPages(templates Templates, posts []PostTemplateData) error {
+	byCategory := make(map[string][]PostTemplateData)
+	for _, post := range posts {
+		byCategory[post.Category] = append(byCategory[post.Category], post)
+	}
+
+	var counts []CategoryCount
+	for _, category := range allowedCategories {
+		categoryPosts := byCategory[category]
+		if len(categoryPosts) == 0 {
+			continue
+		}
+		counts = append(counts, CategoryCount{
+			Name:  category,
+			Upper: strings.ToUpper(category),
+			Count: len(categoryPosts),
+		})
+
+		data := CategoryPageData{
+			PageType:        "category",
+			Title:           strings.ToUpper(category[:1]) + category[1:],
+			BasePath:        basePath,
+			Site:            site,
+			Data:            siteData,
+			Menu:            siteMenu,
+			Category:        category,
+			CategoryUpper:   strings.ToUpper(category),
+			Writings:        categoryPosts,
+			GroupedWritings: groupPostsByYear(categoryPosts),
+		}
+		categoryDir := filepath.Join(outputDir, "writings", "category", category)
+		if err := writeTemplate(templates, "category.html", filepath.Join(categoryDir, "index.html"), data); err != nil {
+			return fmt.Errorf("%s: %w", category, err)
+		}
+		if err := generateCategoryRSSFeed(category, categoryPosts); err != nil {
+			return fmt.Errorf("%s feed: %w", category, err)
+		}
+	}
+
+	// Most used categories first, ties in the allowed list order
+	sort.SliceStable(counts, func(i, j int) bool {
+		return counts[i].Count > counts[j].Count
+	})
+
+	data := CategoriesPageData{
+		PageType:   "categories",
+		Title:      "Categories",
+		BasePath:   basePath,
+		Site:       site,
+		Data:       siteData,
+		Menu:       siteMenu,
+		Categories: counts,
+	}
+	return writeTemplate(templates, "categories.html", filepath.Join(outputDir, "writings", "category", "index.html"), data)
+}
+
+// generateTagPages writes tags/index.html and a tags/{tag}/ listing per tag
+func generateTagPages(templates Templates, posts []PostTemplateData) error {
+	byTag := make(map[string][]PostTemplateData)
+	for _, post := range posts {
+		for _, tag := range post.Tags {
+			byTag[tag] = append(byTag[tag], post)
+		}
+	}
+
+	var counts []TagCount
+	for tag, tagPosts := range byTag {
+		counts = append(counts, TagCount{Name: tag, Count: len(tagPosts)})
+
+		data := TagPageData{
+			PageType:        "tag",
+			Title:           "#" + tag,
+			BasePath:        basePath,
+			Site:            site,
+			Data:            siteData,
+			Menu:            siteMenu,
+			Tag:             tag,
+			Writings:        tagPosts,
+			GroupedWritings: groupPostsByYear(tagPosts),
+		}
+		if err := writeTemplate(templates, "tag.html", filepath.Join(outputDir, "tags", tag, "index.html"), data); err != nil {
+			return fmt.Errorf("%s: %w", tag, err)
+		}
+	}
+
+	// Most used tags first, then alphabetical
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Name < counts[j].Name
+	})
+
+	data := TagsPageData{
+		PageType: "tags",
+		Title:    "Tags",
+		BasePath: basePath,
+		Site:     site,
+		Data:     siteData,
+		Menu:     siteMenu,
+		Tags:     counts,
+	}
+	return writeTemplate(templates, "tags.html", filepath.Join(outputDir, "tags", "index.html"), data)
+}
+
+// generateAliasPages writes a redirect page at writings/{alias}/ for every
+// alias, pointing at the post's current URL
+func generateAliasPages(templates Templates, posts []PostTemplateData) error {
+	siteURL := getSiteURL()
+	for _, post := range posts {
+		target := basePath + "writings/" + post.Slug + "/"
+		for _, alias := range post.Aliases {
+			data := AliasPageData{
+				PageType:     "alias",
+				Title:        post.Title,
+				BasePath:     basePath,
+				Site:         site,
+				Data:         siteData,
+				Target:       target,
+				CanonicalURL: siteURL + target,
+			}
+			aliasPath := filepath.Join(outputDir, "writings", alias, "index.html")
+			if err := writeTemplate(templates, "alias.html", aliasPath, data); err != nil {
+				return fmt.Errorf("%s: %w", alias, err)
+			}
+		}
+	}
+	return nil
+}
+
+// groupPostsBySeries maps each series slug to its posts in series order
+func groupPostsBySeries(posts []PostTemplateData) map[string][]PostTemplateData {
+	series := make(map[string][]PostTemplateData)
+	for _, post := range posts {
+		if post.Series != "" {
+			series[post.SeriesSlug] = append(series[post.SeriesSlug], post)
+		}
+	}
+	for _, seriesPosts := range series {
+		sort.Slice(seriesPosts, func(i, j int) bool {
+			return seriesPosts[i].SeriesOrder < seriesPosts[j].SeriesOrder
+		})
+	}
+	return series
+}
+
+// generateSeriesPages writes series/{name}/index.html for every series
+func generateSeriesPages(templates Templates, series map[string][]PostTemplateData) error {
+	for seriesSlug, seriesPosts := range series {
+		data := SeriesPageData{
+			PageType:   "series",
+			Title:      seriesPosts[0].Series,
+			BasePath:   basePath,
+			Site:       site,
+			Data:       siteData,
+			Menu:       siteMenu,
+			Series:     seriesPosts[0].Series,
+			SeriesSlug: seriesSlug,
+			Posts:      seriesPosts,
+		}
+		if err := writeTemplate(templates, "series.html", filepath.Join(outputDir, "series", seriesSlug, "index.html"), data); err != nil {
+			return fmt.Errorf("%s: %w", seriesSlug, err)
+		}
+	}
+	return nil
+}
+
+// generatePostPage writes writings/{slug}/index.html. series holds the
+// posts of the post's series in order, or nil.
+func generatePostPage(templates Templates, post PostTemplateData, series []PostTemplateData) error {
 	// Create writings/{slug}/index.html structure
 	postDir := filepath.Join(outputDir, "writings", post.Slug)
 	if err := os.MkdirAll(postDir, 0755); err != nil {
@@ -368,64 +1692,253 @@ func generatePostPage(templates *template.Template, post PostTemplateData) error
 		PageType: "post",
 		Title:    post.Title,
 		BasePath: basePath,
+		Site:     site,
+		Data:     siteData,
+		Menu:     siteMenu,
 		Post:     post,
 	}
 
-	return writeTemplate(templates, "post.html", filepath.Join(postDir, "index.html"), data)
+	if post.Series != "" {
+		data.Series = post.Series
+		data.SeriesSlug = post.SeriesSlug
+		data.SeriesPosts = series
+		for i := range series {
+			if series[i].Slug != post.Slug {
+				continue
+			}
+			if i > 0 {
+				data.SeriesPrev = &series[i-1]
+			}
+			if i < len(series)-1 {
+				data.SeriesNext = &series[i+1]
+			}
+		}
+	}
+
+	return writeTemplate(templates, post.Layout+".html", filepath.Join(postDir, "index.html"), data)
 }
 
-func generateAboutPage(templates *template.Template) error {
-	data := AboutPageData{
-		PageType: "about",
-		Title:    "About",
-		BasePath: basePath,
+// loadData reads the JSON, YAML and CSV files under dir into one map for
+// templates. data/social.yaml is .Data.social and data/books/2026.csv is
+// .Data.books.2026 (index "2026" in templates). CSV files become a list of
+// rows keyed by the header row.
+func loadData(dir string) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return data, nil
 	}
 
-	aboutDir := filepath.Join(outputDir, "about")
-	if err := os.MkdirAll(aboutDir, 0755); err != nil {
-		return err
-	}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if d.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml" && ext != ".csv") {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("difficulty in reading %s: %w", path, err)
+		}
 
-	return writeTemplate(templates, "about.html", filepath.Join(aboutDir, "index.html"), data)
+		var value interface{}
+		switch ext {
+		case ".json":
+			if err := json.Unmarshal(content, &value); err != nil {
+				return fmt.Errorf("%s: invalid JSON: %w", path, err)
+			}
+		case ".yaml", ".yml":
+			if err := yaml.Unmarshal(content, &value); err != nil {
+				return yamlError(path, 1, "data", err)
+			}
+		case ".csv":
+			records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+			if err != nil {
+				return fmt.Errorf("%s: invalid CSV: %w", path, err)
+			}
+			var rows []map[string]string
+			for _, record := range records[min(1, len(records)):] {
+				row := make(map[string]string)
+				for i, column := range records[0] {
+					row[strings.TrimSpace(column)] = record[i]
+				}
+				rows = append(rows, row)
+			}
+			value = rows
+		}
+
+		// Nest by directory: books/2026.csv → data["books"]["2026"]
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		keys := strings.Split(strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel)), "/")
+		parent := data
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := parent[key].(map[string]interface{})
+			if !ok {
+				if _, taken := parent[key]; taken {
+					return fmt.Errorf("%s: %q is both a file and a directory in %s", path, key, dir)
+				}
+				child = make(map[string]interface{})
+				parent[key] = child
+			}
+			parent = child
+		}
+		key := keys[len(keys)-1]
+		if _, taken := parent[key]; taken {
+			return fmt.Errorf("%s: another data file is already named %q", path, key)
+		}
+		parent[key] = value
+		return nil
+	})
+	return data, err
 }
 
-func generateForAIPage(templates *template.Template) error {
-	data := AboutPageData{
-		PageType: "forai",
-		Title:    "For AI",
-		BasePath: basePath,
+// loadPages reads every markdown file under content/pages. Each becomes a
+// page at its own path: pages/now.md → /now/, pages/a/b.md → /a/b/.
+func loadPages() ([]Page, []error) {
+	if _, err := os.Stat(pagesDir); os.IsNotExist(err) {
+		return nil, nil
 	}
 
-	foraiDir := filepath.Join(outputDir, "forai")
-	if err := os.MkdirAll(foraiDir, 0755); err != nil {
-		return err
+	var pages []Page
+	var errs []error
+	owners := make(map[string]string)
+	err := filepath.WalkDir(pagesDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".md") || strings.Contains(filepath.Base(path), "README") {
+			return nil
+		}
+		page, err := processPageFile(path)
+		if err != nil {
+			if !strings.HasPrefix(err.Error(), path) {
+				err = fmt.Errorf("%s: %w", path, err)
+			}
+			errs = append(errs, err)
+			return nil
+		}
+		if owner, ok := owners[page.Path]; ok {
+			errs = append(errs, fmt.Errorf("page path %q used by both %s and %s", page.Path, owner, path))
+			return nil
+		}
+		owners[page.Path] = path
+		pages = append(pages, *page)
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
 	}
+	return pages, errs
+}
 
-	return writeTemplate(templates, "forai.html", filepath.Join(foraiDir, "index.html"), data)
+// reservedPagePaths are top-level outputs the generator already owns
+var reservedPagePaths = map[string]bool{
+	"writings": true, "tags": true, "series": true, "css": true, "images": true, "rss.xml": true,
 }
 
-func generateMetaPage(templates *template.Template, buildDuration time.Duration) error {
-	buildYear := time.Now().Year()
-	buildTimeMs := buildDuration.Milliseconds()
-	buildTimeStr := fmt.Sprintf("%d", buildTimeMs)
+func processPageFile(filePath string) (*Page, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("difficulty in reading the page: %w", err)
+	}
+
+	var frontmatter PageFrontmatter
+	body := string(content)
+	if fmContent, rest, found := splitFrontmatter(body); found {
+		if err := parseFrontmatter(filePath, fmContent, 2, &frontmatter); err != nil {
+			return nil, err
+		}
+		body = rest
+	}
+	if strings.TrimSpace(frontmatter.Title) == "" {
+		return nil, fmt.Errorf("page has no title")
+	}
+
+	rel, err := filepath.Rel(pagesDir, filePath)
+	if err != nil {
+		return nil, err
+	}
+	pagePath := strings.TrimSuffix(filepath.ToSlash(rel), ".md")
+	// about/index.md is the about page, like about.md
+	if path.Base(pagePath) == "index" {
+		pagePath = path.Dir(pagePath)
+	}
+	if pagePath == "." {
+		return nil, fmt.Errorf("a page cannot replace the home page")
+	}
+	if reservedPagePaths[strings.SplitN(pagePath, "/", 2)[0]] {
+		return nil, fmt.Errorf("page path %q is reserved by the generator", pagePath)
+	}
 
-	data := MetaPageData{
-		PageType:  "meta",
-		Title:     "Meta",
-		BasePath:  basePath,
-		BuildYear: buildYear,
-		BuildTime: buildTimeStr,
+	layout := frontmatter.Layout
+	if layout == "" {
+		layout = "page"
 	}
 
-	metaDir := filepath.Join(outputDir, "meta")
-	if err := os.MkdirAll(metaDir, 0755); err != nil {
-		return err
+	// Pages are written by hand, so raw HTML in them is allowed
+	var htmlContent strings.Builder
+	if err := newMarkdown(goldmarkhtml.WithUnsafe()).Convert([]byte(body), &htmlContent); err != nil {
+		return nil, fmt.Errorf("difficulty in converting the page: %w", err)
+	}
+
+	variants := make(map[string]string)
+	return &Page{
+		Title:         strings.TrimSpace(frontmatter.Title),
+		Description:   frontmatter.Description,
+		Path:          pagePath,
+		Layout:        layout,
+		Menu:          frontmatter.Menu,
+		Content:       template.HTML(postProcessImages(htmlContent.String(), imageSizes(layout), variants)),
+		Params:        frontmatter.Params,
+		SourcePath:    filePath,
+		ImageVariants: variants,
+	}, nil
+}
+
+// buildMenu returns the pages with a menu position, in menu order
+func buildMenu(pages []Page) []MenuItem {
+	var menu []MenuItem
+	for _, page := range pages {
+		if page.Menu > 0 {
+			menu = append(menu, MenuItem{Title: page.Title, Path: page.Path, Order: page.Menu})
+		}
 	}
+	sort.SliceStable(menu, func(i, j int) bool {
+		return menu[i].Order < menu[j].Order
+	})
+	return menu
+}
 
-	return writeTemplate(templates, "meta.html", filepath.Join(metaDir, "index.html"), data)
+// generatePages writes every standalone page through its layout template,
+// carrying on past a broken page so all of them are reported
+func generatePages(templates Templates, pages []Page, buildDuration time.Duration) []error {
+	var errs []error
+	for _, page := range pages {
+		data := StandalonePageData{
+			PageType:  path.Base(page.Path),
+			Title:     page.Title,
+			BasePath:  basePath,
+			Site:      site,
+			Data:      siteData,
+			Menu:      siteMenu,
+			Page:      page,
+			BuildYear: time.Now().Year(),
+			BuildTime: fmt.Sprintf("%d", buildDuration.Milliseconds()),
+		}
+
+		outputPath := filepath.Join(outputDir, filepath.FromSlash(page.Path), "index.html")
+		if err := writeTemplate(templates, page.Layout+".html", outputPath, data); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", page.SourcePath, err))
+		}
+	}
+	return errs
 }
 
-func writeTemplate(templates *template.Template, templateName, outputPath string, data interface{}) error {
+func writeTemplate(templates Templates, templateName, outputPath string, data interface{}) error {
 	// Validate template exists
 	if templates.Lookup(templateName) == nil {
 		return fmt.Errorf("template %s not found", templateName)
@@ -441,16 +1954,24 @@ func writeTemplate(templates *template.Template, templateName, outputPath string
 
 	// Execute template to buffer first
 	var buf bytes.Buffer
-	if err := templates.ExecuteTemplate(&buf, templateName, data); err != nil {
+	if err := templates.Execute(&buf, templateName, data); err != nil {
 		return fmt.Errorf("template execution failed: %w", err)
 	}
 
-	// Format HTML
-	formattedHTML, err := formatHTML(buf.Bytes())
+	// Format HTML; --minify takes over from the formatter
+	mode := *htmlMode
+	if minifier != nil {
+		mode = "off"
+	}
+	formattedHTML, err := formatHTML(buf.Bytes(), mode)
 	if err != nil {
 		// If formatting fails, use original (non-critical)
 		formattedHTML = buf.Bytes()
 	}
+	formattedHTML, err = minifyAsset("HTML", "text/html", formattedHTML)
+	if err != nil {
+		return err
+	}
 
 	// Write formatted HTML to file
 	if err := os.WriteFile(outputPath, formattedHTML, 0644); err != nil {
@@ -461,83 +1982,252 @@ func writeTemplate(templates *template.Template, templateName, outputPath string
 	return nil
 }
 
-// formatHTML formats HTML with proper indentation using simple regex-based approach
-func formatHTML(input []byte) ([]byte, error) {
-	inputStr := string(input)
-	
-	// Preserve DOCTYPE
-	doctype := ""
-	if strings.HasPrefix(strings.TrimSpace(inputStr), "<!DOCTYPE") {
-		doctypeIdx := strings.Index(inputStr, "<!DOCTYPE")
-		idx := strings.Index(inputStr[doctypeIdx:], ">")
-		if idx > 0 {
-			doctype = inputStr[doctypeIdx:doctypeIdx+idx+1] + "\n"
-			inputStr = strings.TrimSpace(inputStr[doctypeIdx+idx+1:])
-		}
-	}
-	
-	// Simple formatting: add newlines and indentation
-	// Replace >< with >\n< (except for inline content)
-	inputStr = regexp.MustCompile(`>\s*<`).ReplaceAllString(inputStr, ">\n<")
-	
-	// Add indentation
-	lines := strings.Split(inputStr, "\n")
-	var result []string
-	indent := 0
-	indentStr := "  "
-	
-	voidElements := map[string]bool{
-		"area": true, "base": true, "br": true, "col": true, "embed": true,
-		"hr": true, "img": true, "input": true, "link": true, "meta": true,
-		"param": true, "source": true, "track": true, "wbr": true,
-	}
-	
-	inlineElements := map[string]bool{
-		"a": true, "span": true, "strong": true, "em": true, "code": true,
-		"b": true, "i": true, "small": true, "sub": true, "sup": true,
-	}
-	
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "" {
-			continue
+// formatHTML re-lays out a page with a real HTML tokenizer. "pretty" puts
+// block elements on their own indented lines and keeps inline runs together,
+// "minified" drops the layout whitespace and comments, "off" returns the
+// page untouched. Contents of pre, code, textarea, script and style are
+// copied byte for byte in every mode
+func formatHTML(input []byte, mode string) ([]byte, error) {
+	if mode == "off" {
+		return input, nil
+	}
+
+	f := &htmlFormatter{pretty: mode == "pretty"}
+	tokenizer := html.NewTokenizer(bytes.NewReader(input))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if err := tokenizer.Err(); err != io.EOF {
+				return nil, err
+			}
+			break
 		}
-		
-		// Decrease indent for closing tags
-		if strings.HasPrefix(trimmed, "</") {
-			indent--
-			if indent < 0 {
-				indent = 0
+		raw := append([]byte(nil), tokenizer.Raw()...)
+		name, _ := tokenizer.TagName()
+		tag := string(name)
+
+		// Preformatted content goes through as written until its end tag
+		if f.preserve != "" {
+			f.line.Write(raw)
+			if tag == f.preserve {
+				switch tokenType {
+				case html.StartTagToken:
+					f.preserveDepth++
+				case html.EndTagToken:
+					f.preserveDepth--
+				}
+				if f.preserveDepth == 0 {
+					f.preserve = ""
+					if !inlineElements[tag] {
+						f.flushLine()
+					}
+				}
 			}
+			continue
 		}
-		
-		// Add line with indentation
-		result = append(result, strings.Repeat(indentStr, indent)+trimmed)
-		
-		// Increase indent for opening tags (not void, not self-closing, not inline-only)
-		if strings.HasPrefix(trimmed, "<") && !strings.HasPrefix(trimmed, "</") {
-			// Extract tag name
-			tagName := strings.Fields(strings.TrimPrefix(trimmed, "<"))[0]
-			tagName = strings.TrimSuffix(tagName, ">")
-			tagName = strings.ToLower(tagName)
-			
-			// Check if self-closing
-			isSelfClosing := strings.HasSuffix(trimmed, "/>")
-			
-			if !voidElements[tagName] && !isSelfClosing && !inlineElements[tagName] {
-				indent++
+
+		switch tokenType {
+		case html.DoctypeToken:
+			f.flushLine()
+			f.writeLine(raw)
+		case html.CommentToken:
+			if f.pretty {
+				f.inline(raw)
+			}
+		case html.TextToken:
+			f.text(raw)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			raw = normalizeTag(raw)
+			preserved := preservedElements[tag] && tokenType == html.StartTagToken
+			switch {
+			case inlineElements[tag]:
+				f.inline(raw)
+			case voidElements[tag] || tokenType == html.SelfClosingTagToken || preserved:
+				f.flushLine()
+				f.line.Write(raw)
+				f.lineDepth = f.depth
+			default:
+				f.flushLine()
+				f.line.Write(raw)
+				f.lineDepth = f.depth
+				f.depth++
+				f.openBlock = true
+			}
+			if preserved {
+				f.preserve = tag
+				f.preserveDepth = 1
+			} else if !inlineElements[tag] && !f.openBlock {
+				f.flushLine()
 			}
+		case html.EndTagToken:
+			raw = normalizeTag(raw)
+			if inlineElements[tag] {
+				f.inline(raw)
+				continue
+			}
+			if f.depth > 0 {
+				f.depth--
+			}
+			if f.openBlock {
+				// A block holding only inline content stays on one line
+				f.line.Write(raw)
+				f.flushLine()
+				continue
+			}
+			f.flushLine()
+			f.line.Write(raw)
+			f.lineDepth = f.depth
+			f.flushLine()
 		}
 	}
-	
-	formatted := strings.Join(result, "\n")
-	if doctype != "" {
-		formatted = doctype + formatted
+	f.flushLine()
+	if f.pretty {
+		f.out.WriteByte('\n')
 	}
-	
-	return []byte(formatted), nil
+	return f.out.Bytes(), nil
 }
 
+// htmlFormatter collects one line of output at a time: a block tag, or a
+// run of text and inline elements
+type htmlFormatter struct {
+	pretty bool
+	out    bytes.Buffer
+
+	line      bytes.Buffer
+	lineDepth int
+	depth     int
+	// openBlock is set while the line starts with a block's start tag and
+	// nothing but inline content has followed it
+	openBlock bool
+	// inlineSeen and pendingSpace track whitespace inside an inline run
+	inlineSeen   bool
+	pendingSpace bool
+
+	// preserve is the element whose contents are being copied verbatim
+	preserve      string
+	preserveDepth int
+}
+
+// writeLine adds a finished line to the output
+func (f *htmlFormatter) writeLine(content []byte) {
+	if f.pretty {
+		if f.out.Len() > 0 {
+			f.out.WriteByte('\n')
+		}
+		f.out.WriteString(strings.Repeat("  ", f.lineDepth))
+	}
+	f.out.Write(content)
+}
+
+func (f *htmlFormatter) flushLine() {
+	if f.line.Len() > 0 {
+		f.writeLine(f.line.Bytes())
+		f.line.Reset()
+	}
+	f.openBlock = false
+	f.inlineSeen = false
+	f.pendingSpace = false
+}
+
+// inline appends an inline tag or comment to the current line
+func (f *htmlFormatter) inline(raw []byte) {
+	if f.line.Len() == 0 {
+		f.lineDepth = f.depth
+	}
+	if f.pendingSpace && f.inlineSeen {
+		f.line.WriteByte(' ')
+	}
+	f.pendingSpace = false
+	f.inlineSeen = true
+	f.line.Write(raw)
+}
+
+// text appends text with its whitespace collapsed. Whitespace next to a
+// block boundary doesn't render, so it is dropped
+func (f *htmlFormatter) text(raw []byte) {
+	// Only HTML whitespace collapses; a no-break space is content
+	words := bytes.FieldsFunc(raw, func(r rune) bool {
+		return r < utf8.RuneSelf && isHTMLSpace(byte(r))
+	})
+	if len(words) == 0 {
+		if len(raw) > 0 {
+			f.pendingSpace = true
+		}
+		return
+	}
+	if isHTMLSpace(raw[0]) {
+		f.pendingSpace = true
+	}
+	f.inline(bytes.Join(words, []byte(" ")))
+	f.pendingSpace = isHTMLSpace(raw[len(raw)-1])
+}
+
+func isHTMLSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
+
+// normalizeTag collapses whitespace inside a tag outside quoted attribute
+// values, so attributes wrapped over several lines end up on one
+func normalizeTag(raw []byte) []byte {
+	var out []byte
+	var quote byte
+	space := false
+	for _, b := range raw {
+		if quote != 0 {
+			out = append(out, b)
+			if b == quote {
+				quote = 0
+			}
+			continue
+		}
+		if isHTMLSpace(b) {
+			space = true
+			continue
+		}
+		if space && b != '>' {
+			out = append(out, ' ')
+		}
+		space = false
+		if b == '"' || b == '\'' {
+			quote = b
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+var (
+	voidElements = map[string]bool{
+		"area": true, "base": true, "br": true, "col": true, "embed": true,
+		"hr": true, "img": true, "input": true, "link": true, "meta": true,
+		"param": true, "source": true, "track": true, "wbr": true,
+	}
+
+	// inlineElements flow within a line instead of starting their own. These
+	// are the HTML spec's phrasing content, less script and template, which
+	// never render, plus source, track and param, which only sit inside the
+	// inline media elements
+	inlineElements = map[string]bool{
+		"a": true, "abbr": true, "audio": true, "b": true, "bdi": true,
+		"bdo": true, "br": true, "button": true, "canvas": true, "cite": true,
+		"code": true, "data": true, "datalist": true, "del": true, "dfn": true,
+		"em": true, "embed": true, "i": true, "iframe": true, "img": true,
+		"input": true, "ins": true, "kbd": true, "label": true, "map": true,
+		"mark": true, "math": true, "meter": true, "noscript": true,
+		"object": true, "output": true, "param": true, "picture": true,
+		"progress": true, "q": true, "rp": true, "rt": true, "ruby": true,
+		"s": true, "samp": true, "select": true, "slot": true, "small": true,
+		"source": true, "span": true, "strong": true, "sub": true, "sup": true,
+		"svg": true, "textarea": true, "time": true, "track": true, "u": true,
+		"var": true, "video": true, "wbr": true,
+	}
+
+	// preservedElements have whitespace that matters (or isn't HTML)
+	preservedElements = map[string]bool{
+		"pre": true, "code": true, "textarea": true, "script": true, "style": true,
+	}
+)
+
 func groupPostsByYear(posts []PostTemplateData) []YearGroup {
 	groups := make(map[int][]PostTemplateData)
 	for _, post := range posts {
@@ -621,52 +2311,86 @@ func calculateReadingTime(content string) int {
 	return readingTime
 }
 
-// parseFrontmatter parses simple YAML frontmatter (only handles key: value pairs)
-func parseFrontmatter(yamlContent string, fm *Frontmatter) error {
-	lines := strings.Split(strings.TrimSpace(yamlContent), "\n")
-	
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+// parseFrontmatter decodes the YAML frontmatter into fm (a *Frontmatter or
+// *PageFrontmatter). firstLine is the line of the file the YAML starts on,
+// so errors can point at the source line.
+func parseFrontmatter(filePath string, yamlContent string, firstLine int, fm interface{}) error {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(yamlContent), &node); err != nil {
+		return yamlError(filePath, firstLine, "frontmatter", err)
+	}
+	if len(node.Content) == 0 {
+		return fmt.Errorf("%s:%d: frontmatter is empty", filePath, firstLine)
+	}
+	if err := node.Decode(fm); err != nil {
+		return yamlError(filePath, firstLine, "frontmatter", err)
+	}
+	return nil
+}
+
+// yamlLineRegex matches the "line N" references inside yaml.v3 errors
+var yamlLineRegex = regexp.MustCompile(`line (\d+): (.*)`)
+
+// yamlError rewrites a yaml error as "file:line: what: message", shifting
+// the YAML-relative line number to the line in the file
+func yamlError(filePath string, firstLine int, what string, err error) error {
+	match := yamlLineRegex.FindStringSubmatch(err.Error())
+	if match == nil {
+		return fmt.Errorf("%s: %s: %s", filePath, what, strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+	line, _ := strconv.Atoi(match[1])
+	return fmt.Errorf("%s:%d: %s: %s", filePath, firstLine+line-1, what, match[2])
+}
+
+// splitFrontmatter separates the frontmatter block from the body. The block
+// must open with a line that is exactly "---" and closes at the next such line,
+// so "---" inside a title or value does not end it early.
+func splitFrontmatter(content string) (frontmatter string, body string, found bool) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if !strings.HasPrefix(content, "---\n") {
+		return "", content, false
+	}
+
+	rest := content[len("---\n"):]
+	offset := 0
+	for {
+		end := strings.IndexByte(rest[offset:], '\n')
+		line := rest[offset:]
+		if end >= 0 {
+			line = rest[offset : offset+end]
 		}
-		
-		// Simple key: value parser
-		idx := strings.Index(line, ":")
-		if idx <= 0 {
-			continue
+		if strings.TrimRight(line, " \t") == "---" {
+			if end < 0 {
+				return rest[:offset], "", true
+			}
+			return rest[:offset], rest[offset+end+1:], true
 		}
-		
-		key := strings.TrimSpace(line[:idx])
-		value := strings.TrimSpace(line[idx+1:])
-		
-		// Remove quotes if present
-		value = strings.Trim(value, "\"'")
-		
-		switch strings.ToLower(key) {
-		case "title":
-			fm.Title = value
-		case "category":
-			fm.Category = value
-		case "date":
-			fm.Date = value
-		case "slug":
-			fm.Slug = value
-		case "draft":
-			fm.IsDraft = strings.ToLower(value) == "true"
-		}
-	}
-	
-	return nil
+		if end < 0 {
+			return "", content, false
+		}
+		offset += end + 1
+	}
 }
 
-// Copy functions from original generate-static.go
+// findMarkdownFiles lists the posts under dir. A directory holding an
+// index.md is a page bundle: only its index.md is a post, and everything
+// else in it is an asset of that post, so other Markdown files in it are
+// skipped with a warning.
 func findMarkdownFiles(dir string) ([]string, error) {
 	var files []string
 	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if d.IsDir() && path != dir {
+			index := filepath.Join(path, "index.md")
+			if info, err := os.Stat(index); err == nil && !info.IsDir() {
+				files = append(files, index)
+				warnSkippedMarkdown(path, index)
+				return filepath.SkipDir
+			}
+		}
 		if !d.IsDir() && strings.HasSuffix(path, ".md") {
 			files = append(files, path)
 		}
@@ -675,6 +2399,17 @@ func findMarkdownFiles(dir string) ([]string, error) {
 	return files, err
 }
 
+// warnSkippedMarkdown points out Markdown files inside a bundle, which are
+// not read as posts
+func warnSkippedMarkdown(bundleDir, index string) {
+	_ = filepath.WalkDir(bundleDir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && path != index && strings.HasSuffix(path, ".md") && !strings.Contains(filepath.Base(path), "README") {
+			fmt.Printf("▓▓ WARNING: %s is inside the bundle %s and is not read as a post\n", path, bundleDir)
+		}
+		return nil
+	})
+}
+
 func processPostFile(filePath string) (*Post, error) {
 	// Validate file exists and is readable
 	info, err := os.Stat(filePath)
@@ -698,21 +2433,17 @@ func processPostFile(filePath string) (*Post, error) {
 	var frontmatter Frontmatter
 	rest := content
 
-	// Check for frontmatter delimiter
-	if strings.HasPrefix(string(content), "---") {
-		parts := strings.SplitN(string(content), "---", 3)
-		if len(parts) >= 3 {
-			if len(parts[1]) == 0 {
-				return nil, fmt.Errorf("frontmatter is empty")
-			}
-			// Parse frontmatter manually (simple YAML parser for our needs)
-			if err := parseFrontmatter(parts[1], &frontmatter); err != nil {
-				return nil, fmt.Errorf("difficulty in parsing the frontmatter: %w", err)
-			}
-			rest = []byte(strings.TrimSpace(parts[2]))
-			if len(rest) == 0 {
-				return nil, fmt.Errorf("manuscript has no content after frontmatter")
-			}
+	if fmContent, body, found := splitFrontmatter(string(content)); found {
+		if strings.TrimSpace(fmContent) == "" {
+			return nil, fmt.Errorf("%s:2: frontmatter is empty", filePath)
+		}
+		// The YAML starts on line 2, right after the opening "---"
+		if err := parseFrontmatter(filePath, fmContent, 2, &frontmatter); err != nil {
+			return nil, err
+		}
+		rest = []byte(strings.TrimSpace(body))
+		if len(rest) == 0 {
+			return nil, fmt.Errorf("manuscript has no content after frontmatter")
 		}
 	}
 
@@ -732,22 +2463,37 @@ func processPostFile(filePath string) (*Post, error) {
 		slug = generateSlug(frontmatter.Title)
 	}
 	if slug == "" {
-		return nil, fmt.Errorf("could not generate a valid slug from title")
+		return nil, fmt.Errorf("could not generate a valid slug from title; set slug: in the frontmatter")
+	}
+
+	// Cover image must exist under content/images
+	coverImage, err := resolveCoverImage(frontmatter.CoverImage)
+	if err != nil {
+		return nil, err
 	}
 
-	// Parse date
+	// Scheduling window
+	publishAt, err := parseTimestamp(frontmatter.PublishAt)
+	if err != nil {
+		return nil, fmt.Errorf("publish_at: %w", err)
+	}
+	expireAt, err := parseTimestamp(frontmatter.ExpireAt)
+	if err != nil {
+		return nil, fmt.Errorf("expire_at: %w", err)
+	}
+	if !publishAt.IsZero() && !expireAt.IsZero() && !expireAt.After(publishAt) {
+		return nil, fmt.Errorf("expire_at must be after publish_at")
+	}
+
+	// Dates: frontmatter wins, then git history, then the file's mtime
+	firstCommit, lastCommit := gitDates(filePath)
 	var createdAt time.Time
 	if frontmatter.Date != "" {
 		parsedDate, err := time.Parse("2006-01-02", frontmatter.Date)
 		if err != nil {
 			parsedDate, err = time.Parse(time.RFC3339, frontmatter.Date)
 			if err != nil {
-				info, _ := os.Stat(filePath)
-				if info != nil {
-					createdAt = info.ModTime()
-				} else {
-					createdAt = time.Now()
-				}
+				createdAt = fallbackDate(filePath, firstCommit)
 			} else {
 				createdAt = parsedDate
 			}
@@ -755,87 +2501,442 @@ func processPostFile(filePath string) (*Post, error) {
 			createdAt = parsedDate
 		}
 	} else {
-		info, err := os.Stat(filePath)
-		if err == nil {
-			createdAt = info.ModTime()
-		} else {
-			createdAt = time.Now()
+		createdAt = fallbackDate(filePath, firstCommit)
+	}
+
+	updatedAt := createdAt
+	if frontmatter.Updated != "" {
+		parsedUpdated, err := parseTimestamp(frontmatter.Updated)
+		if err != nil {
+			return nil, fmt.Errorf("updated: %w", err)
 		}
+		updatedAt = parsedUpdated
+	} else if lastCommit.After(firstCommit) && lastCommit.After(updatedAt) {
+		// Only a later commit is an update; a post committed once is not
+		updatedAt = lastCommit
 	}
 
 	// Process markdown content to HTML
-	md := goldmark.New(
-		goldmark.WithExtensions(extension.GFM),
+	rendered, headings, err := renderPostMarkdown(rest)
+	if err != nil {
+		return nil, fmt.Errorf("difficulty in converting the manuscript to print: %w", err)
+	}
+
+	sizes := imageSizes(strings.TrimSpace(frontmatter.Layout))
+	variants := make(map[string]string)
+	htmlStr := postProcessImages(rendered, sizes, variants)
+
+	// Table of contents: frontmatter decides, otherwise the heading count
+	var toc []TOCEntry
+	if frontmatter.TOC != nil && *frontmatter.TOC || frontmatter.TOC == nil && len(headings) >= site.TOC.MinHeadings {
+		toc = headings
+	}
+
+	// Page bundles reference their own files by relative path
+	var bundleDir string
+	var assets []string
+	if filepath.Base(filePath) == "index.md" {
+		bundleDir = filepath.Dir(filePath)
+		htmlStr, assets, err = rewriteBundleImages(htmlStr, bundleDir, slug, sizes, variants)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Build post object
+	post := Post{
+		ID:            slug,
+		Title:         frontmatter.Title,
+		Content:       htmlStr,
+		Category:      frontmatter.Category,
+		Tags:          normalizeTags(frontmatter.Tags),
+		Series:        strings.TrimSpace(frontmatter.Series),
+		SeriesOrder:   frontmatter.SeriesOrder,
+		Aliases:       normalizeAliases(frontmatter.Aliases),
+		Layout:        strings.TrimSpace(frontmatter.Layout),
+		Slug:          slug,
+		IsDraft:       frontmatter.IsDraft,
+		CreatedAt:     createdAt.Format(time.RFC3339),
+		UpdatedAt:     updatedAt.Format(time.RFC3339),
+		SourcePath:    filePath,
+		BundleDir:     bundleDir,
+		Assets:        assets,
+		ImageVariants: variants,
+		PublishAt:     formatTimestamp(publishAt),
+		ExpireAt:      formatTimestamp(expireAt),
+		CoverImage:    coverImage,
+		Edition:       strings.TrimSpace(frontmatter.Edition),
+		TOC:           toc,
+		Params:        frontmatter.Params,
+	}
+
+	post.Category = strings.ToLower(strings.TrimSpace(post.Category))
+	if post.Category == "" {
+		post.Category = "life"
+	}
+	if post.Layout == "" {
+		post.Layout = "post"
+	}
+	if !isAllowedCategory(post.Category) {
+		return nil, fmt.Errorf("unknown category %q (allowed: %s)", post.Category, strings.Join(allowedCategories, ", "))
+	}
+
+	return &post, nil
+}
+
+// bundleImgSrcRegex matches img src attributes as goldmark renders them
+var bundleImgSrcRegex = regexp.MustCompile(`(<img [^>]*src=")([^"]+)(")`)
+
+// rewriteBundleImages points relative image srcs in a bundle post at the
+// copies under writings/{slug}/ and returns the referenced asset paths,
+// relative to bundleDir. Resized copies are recorded in variants
+func rewriteBundleImages(htmlStr, bundleDir, slug, sizes string, variants map[string]string) (string, []string, error) {
+	var assets []string
+	var rewriteErr error
+	seen := make(map[string]bool)
+	htmlStr = bundleImgSrcRegex.ReplaceAllStringFunc(htmlStr, func(match string) string {
+		parts := bundleImgSrcRegex.FindStringSubmatch(match)
+		src := parts[2]
+		if strings.HasPrefix(src, "/") || strings.HasPrefix(src, "#") || strings.Contains(src, ":") {
+			return match // absolute path or URL
+		}
+
+		rel, err := url.PathUnescape(src)
+		if err != nil {
+			rel = src
+		}
+		rel = filepath.ToSlash(filepath.Clean(rel))
+		if strings.HasPrefix(rel, "../") || rel == ".." {
+			if rewriteErr == nil {
+				rewriteErr = fmt.Errorf("image %q points outside the bundle %s", src, bundleDir)
+			}
+			return match
+		}
+		if _, err := os.Stat(filepath.Join(bundleDir, filepath.FromSlash(rel))); err != nil {
+			if rewriteErr == nil {
+				rewriteErr = fmt.Errorf("image %q not found in bundle %s", src, bundleDir)
+			}
+			return match
+		}
+
+		if !seen[rel] {
+			seen[rel] = true
+			assets = append(assets, rel)
+		}
+		publicURL := basePath + "writings/" + url.PathEscape(slug) + "/" + src
+		attrs, err := responsiveImageAttrs(match, filepath.Join(bundleDir, filepath.FromSlash(rel)), filepath.Join(outputDir, "writings", slug, filepath.FromSlash(rel)), publicURL, sizes, variants)
+		if err != nil && rewriteErr == nil {
+			rewriteErr = fmt.Errorf("image %q in bundle %s: %w", src, bundleDir, err)
+		}
+		return parts[1] + publicURL + parts[3] + attrs
+	})
+	return htmlStr, assets, rewriteErr
+}
+
+// copyBundleAssets copies the files referenced by bundle posts next to
+// their writings/{slug}/index.html
+func copyBundleAssets(posts []Post) error {
+	var copied int
+	for _, post := range posts {
+		for _, rel := range post.Assets {
+			srcPath := filepath.Join(post.BundleDir, filepath.FromSlash(rel))
+			destPath := filepath.Join(outputDir, "writings", post.Slug, filepath.FromSlash(rel))
+			if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+				return err
+			}
+			srcData, err := os.ReadFile(srcPath)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(destPath, srcData, 0644); err != nil {
+				return err
+			}
+			copied++
+		}
+	}
+	if copied > 0 {
+		fmt.Printf("▓▓ COPIED %d BUNDLE ASSET%s\n", copied, strings.ToUpper(plural(copied)))
+	}
+	return nil
+}
+
+// newMarkdown returns the goldmark converter shared by posts and pages
+func newMarkdown(rendererOptions ...renderer.Option) goldmark.Markdown {
+	rendererOptions = append([]renderer.Option{
+		goldmarkhtml.WithHardWraps(),
+		goldmarkhtml.WithXHTML(),
+	}, rendererOptions...)
+
+	return goldmark.New(
+		goldmark.WithExtensions(
+			extension.GFM,
+			// Code is highlighted at build time into CSS classes that
+			// css/syntax.css styles, so pages need no script for it
+			highlighting.NewHighlighting(
+				highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+				highlighting.WithWrapperRenderer(codeBlockWrapper),
+			),
+		),
 		goldmark.WithParserOptions(
 			parser.WithAutoHeadingID(),
 		),
-		goldmark.WithRendererOptions(
-			goldmarkhtml.WithHardWraps(),
-			goldmarkhtml.WithXHTML(),
-		),
+		goldmark.WithRendererOptions(rendererOptions...),
 	)
+}
 
-	var htmlContent strings.Builder
-	if err := md.Convert(rest, &htmlContent); err != nil {
-		return nil, fmt.Errorf("difficulty in converting the manuscript to print: %w", err)
+// codeBlockWrapper puts a fenced code block with a title attribute
+// (```sh {title="install.sh"}) in a figure captioned with the title. Blocks
+// Chroma doesn't highlight get the plain <pre><code> goldmark would write
+func codeBlockWrapper(w util.BufWriter, ctx highlighting.CodeBlockContext, entering bool) {
+	var title string
+	if attrs := ctx.Attributes(); attrs != nil {
+		if value, ok := attrs.GetString("title"); ok {
+			if b, ok := value.([]byte); ok {
+				title = string(b)
+			}
+		}
+	}
+
+	if entering {
+		if title != "" {
+			w.WriteString(`<figure class="code-block"><figcaption>` + template.HTMLEscapeString(title) + "</figcaption>")
+		}
+		if !ctx.Highlighted() {
+			w.WriteString("<pre><code")
+			if language, ok := ctx.Language(); ok {
+				w.WriteString(` class="language-` + template.HTMLEscapeString(string(language)) + `"`)
+			}
+			w.WriteString(">")
+		}
+		return
+	}
+
+	if !ctx.Highlighted() {
+		w.WriteString("</code></pre>\n")
+	}
+	if title != "" {
+		w.WriteString("</figure>\n")
+	}
+}
+
+// writeSyntaxCSS generates css/syntax.css from the highlight styles in
+// site.yaml, the dark one applying under prefers-color-scheme: dark
+func writeSyntaxCSS() error {
+	formatter := chromahtml.New(chromahtml.WithClasses(true))
+
+	var light, dark bytes.Buffer
+	if err := formatter.WriteCSS(&light, styles.Get(site.Highlight.Light)); err != nil {
+		return err
+	}
+	if err := formatter.WriteCSS(&dark, styles.Get(site.Highlight.Dark)); err != nil {
+		return err
+	}
+
+	var css strings.Builder
+	css.WriteString("/* Generated from the highlight styles in site.yaml */\n")
+	css.Write(light.Bytes())
+	css.WriteString("\n@media (prefers-color-scheme: dark) {\n")
+	for _, line := range strings.Split(strings.TrimSpace(dark.String()), "\n") {
+		css.WriteString("  " + line + "\n")
+	}
+	css.WriteString("}\n")
+
+	minified, err := minifyAsset("CSS", "text/css", []byte(css.String()))
+	if err != nil {
+		return err
+	}
+	return writeAsset("css/syntax.css", minified)
+}
+
+// TOC headings are h2 and h3; h1 is the post title
+const (
+	tocMinLevel = 2
+	tocMaxLevel = 3
+)
+
+// renderPostMarkdown converts a post body to HTML. Every heading gets a
+// unique ID and a self-link anchor, and the h2/h3 headings are returned
+// for the table of contents
+func renderPostMarkdown(source []byte) (string, []TOCEntry, error) {
+	md := newMarkdown()
+	ctx := parser.NewContext(parser.WithIDs(&headingIDs{seen: map[string]bool{}}))
+	doc := md.Parser().Parse(text.NewReader(source), parser.WithContext(ctx))
+
+	var headings []TOCEntry
+	err := ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := node.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		value, ok := heading.AttributeString("id")
+		if !ok {
+			return ast.WalkSkipChildren, nil
+		}
+		id := string(value.([]byte))
+		if heading.Level >= tocMinLevel && heading.Level <= tocMaxLevel {
+			headings = append(headings, TOCEntry{
+				Level: heading.Level,
+				ID:    id,
+				Text:  strings.TrimSpace(string(heading.Text(source))),
+			})
+		}
+		// The anchor is empty so excerpts and feeds don't pick up a
+		// stray "#"; the stylesheet draws it
+		anchor := ast.NewLink()
+		anchor.Destination = []byte("#" + id)
+		anchor.Title = []byte("Link to this section")
+		anchor.SetAttributeString("class", []byte("heading-anchor"))
+		heading.AppendChild(heading, anchor)
+		return ast.WalkSkipChildren, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	var buf strings.Builder
+	if err := md.Renderer().Render(&buf, source, doc); err != nil {
+		return "", nil, err
 	}
+	return buf.String(), headings, nil
+}
+
+// headingIDs gives headings slug IDs the same way post slugs are made. A
+// repeated heading gets -2, -3, ... in document order, skipping any ID
+// already taken, so the IDs are stable between builds
+type headingIDs struct {
+	seen map[string]bool
+}
+
+func (ids *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	base := generateSlug(string(value))
+	if base == "" {
+		base = "section"
+	}
+	id := base
+	for n := 2; ids.seen[id]; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	ids.seen[id] = true
+	return []byte(id)
+}
+
+func (ids *headingIDs) Put(value []byte) {
+	ids.seen[string(value)] = true
+}
+
+// imgTagRegex matches a whole <img> tag, imgSrcRegex a src under /images/
+// in either quote style
+var (
+	imgTagRegex = regexp.MustCompile(`<img [^>]*>`)
+	imgSrcRegex = regexp.MustCompile(`src=(["'])(/images/[^"']+)["']`)
+)
 
-	// Post-process HTML to add lazy loading to images and fix image paths
-	htmlStr := htmlContent.String()
+// postProcessImages adds lazy loading to images, prefixes /images/ srcs
+// with basePath (for GitHub Pages compatibility) and gives them their
+// intrinsic size and a srcset described by sizes, recording the resized
+// copies in variants
+func postProcessImages(htmlStr, sizes string, variants map[string]string) string {
 	htmlStr = strings.ReplaceAll(htmlStr, "<img ", "<img loading=\"lazy\" decoding=\"async\" ")
 
-	// Fix image src paths to include base path (for GitHub Pages compatibility)
-	// Match src="/images/..." or src='/images/...' and prepend basePath
-	if basePath != "/" {
-		// Match src="/images/..." or src='/images/...'
-		imgSrcRegex := regexp.MustCompile(`src=["'](/images/[^"']+)["']`)
-		htmlStr = imgSrcRegex.ReplaceAllStringFunc(htmlStr, func(match string) string {
-			// Extract the path
-			pathMatch := regexp.MustCompile(`src=["'](/images/[^"']+)["']`)
-			submatches := pathMatch.FindStringSubmatch(match)
-			if len(submatches) > 1 {
-				// Prepend basePath (which already ends with /)
-				newPath := basePath + strings.TrimPrefix(submatches[1], "/")
-				// Preserve the original quote style
-				quote := ""
-				if strings.Contains(match, `"`) {
-					quote = `"`
-				} else {
-					quote = `'`
-				}
-				return `src=` + quote + newPath + quote
+	// Images under /images/ get basePath, their size and a srcset
+	return imgTagRegex.ReplaceAllStringFunc(htmlStr, func(tag string) string {
+		loc := imgSrcRegex.FindStringSubmatchIndex(tag)
+		if loc == nil {
+			return tag
+		}
+		// Preserve the original quote style
+		quote, src := tag[loc[2]:loc[3]], tag[loc[4]:loc[5]]
+		publicURL := withBasePath(src)
+
+		rel := strings.TrimPrefix(src, "/images/")
+		if i := strings.IndexAny(rel, "?#"); i >= 0 {
+			rel = rel[:i]
+		}
+		if unescaped, err := url.PathUnescape(rel); err == nil {
+			rel = unescaped
+		}
+		rel = filepath.ToSlash(filepath.Clean(rel))
+		var attrs string
+		if !strings.HasPrefix(rel, "../") && rel != ".." {
+			var err error
+			attrs, err = responsiveImageAttrs(tag, filepath.Join(imagesDir, filepath.FromSlash(rel)), filepath.Join(publicImagesDir, filepath.FromSlash(rel)), publicURL, sizes, variants)
+			if err != nil {
+				fmt.Printf("▓▓ WARNING: image %s: %v\n", src, err)
 			}
-			return match
-		})
+		}
+		return tag[:loc[0]] + "src=" + quote + publicURL + quote + attrs + tag[loc[1]:]
+	})
+}
+
+// withBasePath prefixes a site-absolute path such as /images/a.webp with
+// basePath (which already ends with /)
+func withBasePath(sitePath string) string {
+	return basePath + strings.TrimPrefix(sitePath, "/")
+}
+
+// resolveCoverImage normalizes a cover_image value to a /images/ site path
+// and checks the file exists. Values may be given as /images/x.webp or
+// relative to the images directory, as x.webp.
+func resolveCoverImage(cover string) (string, error) {
+	cover = strings.TrimSpace(cover)
+	if cover == "" {
+		return "", nil
 	}
 
-	// Build post object
-	post := Post{
-		ID:        slug,
-		Title:     frontmatter.Title,
-		Content:   htmlStr,
-		Category:  frontmatter.Category,
-		Slug:      slug,
-		IsDraft:   frontmatter.IsDraft,
-		CreatedAt: createdAt.Format(time.RFC3339),
-		UpdatedAt: createdAt.Format(time.RFC3339),
+	rel := strings.TrimPrefix(strings.TrimPrefix(cover, "/"), "images/")
+	rel = filepath.ToSlash(filepath.Clean(rel))
+	if rel == "." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("cover_image %q must point inside %s", cover, imagesDir)
 	}
 
-	if post.Category == "" {
-		post.Category = "life"
+	info, err := os.Stat(filepath.Join(imagesDir, filepath.FromSlash(rel)))
+	if err != nil || info.IsDir() {
+		return "", fmt.Errorf("cover_image %q not found in %s", cover, imagesDir)
 	}
 
-	return &post, nil
+	return "/images/" + rel, nil
+}
+
+// coverImageURL returns the cover image URL with basePath applied
+func coverImageURL(coverImage string) string {
+	if coverImage == "" {
+		return ""
+	}
+	return withBasePath(coverImage)
 }
 
+// generateSlug turns a title into a URL slug. By default non-Latin scripts
+// are transliterated to ASCII; with slug_mode: unicode (or SLUG_MODE=unicode)
+// letters from any script are kept as-is and get percent-encoded in URLs.
+// A title in a script with no transliteration gets a Unicode slug either way.
 func generateSlug(title string) string {
-	slug := strings.ToLower(title)
+	slug := buildSlug(title, slugMode)
+	if slug == "" && slugMode == "ascii" {
+		slug = buildSlug(title, "unicode")
+	}
+	return slug
+}
+
+// buildSlug is generateSlug for one slug mode
+func buildSlug(title, mode string) string {
+	slug := strings.ToLower(norm.NFC.String(title))
 	slug = strings.TrimSpace(slug)
 	slug = strings.ReplaceAll(slug, " ", "-")
 	slug = strings.ReplaceAll(slug, "_", "-")
+	if mode == "unicode" {
+		var result strings.Builder
+		for _, r := range slug {
+			if unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.M, r) || r == '-' {
+				result.WriteRune(r)
+			}
+		}
+		slug = result.String()
+	} else {
+		slug = transliterate(slug)
+	}
 	var result strings.Builder
 	for _, r := range slug {
-		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || (mode == "unicode" && r > unicode.MaxASCII) {
 			result.WriteRune(r)
 		}
 	}
@@ -847,38 +2948,365 @@ func generateSlug(title string) string {
 	return slug
 }
 
+// Tamil letters, romanized the way the site header is ("தெரியல" → "theriyala")
+var (
+	tamilVowels = map[rune]string{
+		'அ': "a", 'ஆ': "aa", 'இ': "i", 'ஈ': "ii", 'உ': "u", 'ஊ': "uu",
+		'எ': "e", 'ஏ': "ee", 'ஐ': "ai", 'ஒ': "o", 'ஓ': "oo", 'ஔ': "au", 'ஃ': "h",
+	}
+	tamilConsonants = map[rune]string{
+		'க': "k", 'ங': "ng", 'ச': "ch", 'ஞ': "nj", 'ட': "t", 'ண': "n",
+		'த': "th", 'ந': "n", 'ப': "p", 'ம': "m", 'ய': "y", 'ர': "r",
+		'ல': "l", 'வ': "v", 'ழ': "zh", 'ள': "l", 'ற': "r", 'ன': "n",
+		'ஜ': "j", 'ஶ': "sh", 'ஷ': "sh", 'ஸ': "s", 'ஹ': "h",
+	}
+	tamilVowelSigns = map[rune]string{
+		'ா': "aa", 'ி': "i", 'ீ': "ii", 'ு': "u", 'ூ': "uu", 'ெ': "e",
+		'ே': "ee", 'ை': "ai", 'ொ': "o", 'ோ': "oo", 'ௌ': "au",
+	}
+	tamilPulli = '்'
+)
+
+// Other scripts and Latin letters that do not decompose into ASCII
+var transliterations = map[rune]string{
+	// Latin
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'ł': "l", 'þ': "th", 'ı': "i",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+	'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+	'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+}
+
+// transliterate rewrites s in ASCII where it knows how. Tamil consonants
+// carry an inherent "a" unless followed by a vowel sign or pulli; accented
+// Latin letters lose their accents; anything unknown is left for the caller
+// to drop.
+func transliterate(s string) string {
+	runes := []rune(s)
+	var out strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if v, ok := tamilVowels[r]; ok {
+			out.WriteString(v)
+			continue
+		}
+		if c, ok := tamilConsonants[r]; ok {
+			out.WriteString(c)
+			if i+1 < len(runes) {
+				if runes[i+1] == tamilPulli {
+					i++
+					continue
+				}
+				if sign, ok := tamilVowelSigns[runes[i+1]]; ok {
+					out.WriteString(sign)
+					i++
+					continue
+				}
+			}
+			out.WriteString("a")
+			continue
+		}
+		if r >= '௦' && r <= '௯' {
+			out.WriteRune('0' + (r - '௦'))
+			continue
+		}
+		if t, ok := transliterations[r]; ok {
+			out.WriteString(t)
+			continue
+		}
+		if r > unicode.MaxASCII {
+			// Strip accents: é → e + combining mark, έ → ε + combining mark
+			for _, d := range norm.NFD.String(string(r)) {
+				if d <= unicode.MaxASCII {
+					out.WriteRune(d)
+				} else if t, ok := transliterations[d]; ok {
+					out.WriteString(t)
+				}
+			}
+			continue
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
 func copyStaticFiles() error {
 	// Validate static directory exists
-	if _, err := os.Stat(staticDir); os.IsNotExist(err) {
+	dirs := existingDirs(staticDirs())
+	if len(dirs) == 0 {
 		return fmt.Errorf("static directory not found: %s", staticDir)
 	}
 
-	// Copy all static files (including styles)
-	err := filepath.Walk(staticDir, func(path string, info fs.FileInfo, err error) error {
+	// Collect all static files (including styles), the theme's first so
+	// the project's files replace any with the same path
+	files := map[string]string{}
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+
+			relPath, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(relPath)] = path
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Everything but stylesheets is copied as is, first, so the
+	// stylesheets can point at the fingerprinted names
+	var stylesheets []string
+	for _, name := range sortedKeys(files) {
+		if strings.EqualFold(path.Ext(name), ".css") {
+			stylesheets = append(stylesheets, name)
+			continue
+		}
+		srcData, err := os.ReadFile(files[name])
 		if err != nil {
 			return err
 		}
+		if err := writeAsset(name, srcData); err != nil {
+			return err
+		}
+	}
 
-		relPath, err := filepath.Rel(staticDir, path)
+	// Stylesheets are bundled: local @imports are inlined and url()s
+	// rewritten. Partials (_name.css) only exist to be imported
+	for _, name := range stylesheets {
+		if strings.HasPrefix(path.Base(name), "_") {
+			continue
+		}
+		bundle, err := bundleCSS(name, files, nil)
+		if err != nil {
+			return err
+		}
+		bundle = hoistCSSImports(bundle)
+		minified, err := minifyAsset("CSS", "text/css", []byte(bundle))
 		if err != nil {
+			return fmt.Errorf("%s: %w", files[name], err)
+		}
+		if err := writeAsset(name, minified); err != nil {
 			return err
 		}
+	}
 
-		dstPath := filepath.Join(outputDir, relPath)
+	return nil
+}
 
-		if info.IsDir() {
-			return os.MkdirAll(dstPath, 0755)
-		}
+var (
+	// cssImportRegex matches @import "x.css" media; and @import url(x.css) media;
+	// with the media query on the same line
+	cssImportRegex = regexp.MustCompile(`@import\s+(?:url\(\s*)?["']?([^"')\s;]+)["']?[ \t]*\)?[ \t]*([^;\n]*);`)
+	// cssURLRegex matches url(...) references
+	cssURLRegex = regexp.MustCompile(`url\(\s*["']?([^"')]+?)["']?\s*\)`)
+)
 
-		srcData, err := os.ReadFile(path)
+// bundleCSS returns the stylesheet name (a slash path under static/) with
+// its local @imports inlined, recursively, and every url() rewritten to a
+// basePath URL of the fingerprinted file. Comments are dropped, except
+// /*! license */ ones. imports is the chain of stylesheets that led here,
+// to catch cycles
+func bundleCSS(name string, files map[string]string, imports []string) (string, error) {
+	for _, imported := range imports {
+		if imported == name {
+			return "", fmt.Errorf("@import cycle: %s", strings.Join(append(imports, name), " → "))
+		}
+	}
+	srcPath, ok := files[name]
+	if !ok {
+		return "", fmt.Errorf("%s: @import %q not found", files[imports[len(imports)-1]], name)
+	}
+	content, err := os.ReadFile(srcPath)
+	if err != nil {
+		return "", err
+	}
+	css := strings.TrimPrefix(string(content), "\ufeff")
+	dir := path.Dir(name)
+
+	// Commented-out @imports and url()s must not be followed
+	css = stripCSSComments(css)
+
+	// Imports are swapped for placeholders while this file's url()s are
+	// rewritten, since the imported files have rewritten their own
+	var inlined []string
+	var importErr error
+	css = cssImportRegex.ReplaceAllStringFunc(css, func(match string) string {
+		parts := cssImportRegex.FindStringSubmatch(match)
+		target, media := parts[1], strings.TrimSpace(parts[2])
+		if isExternalURL(target) || importErr != nil {
+			return match
+		}
+		bundle, err := bundleCSS(resolveStaticPath(dir, target), files, append(imports, name))
 		if err != nil {
-			return err
+			importErr = err
+			return match
 		}
+		if media != "" {
+			bundle = "@media " + media + " {\n" + bundle + "\n}"
+		}
+		inlined = append(inlined, bundle)
+		return fmt.Sprintf("/*@import %d*/", len(inlined)-1)
+	})
+	if importErr != nil {
+		return "", importErr
+	}
+
+	css = cssURLRegex.ReplaceAllStringFunc(css, func(match string) string {
+		ref := strings.TrimSpace(cssURLRegex.FindStringSubmatch(match)[1])
+		if isExternalURL(ref) || strings.HasPrefix(ref, "data:") || strings.HasPrefix(ref, "#") {
+			return match
+		}
+		// Fonts often carry ?#iefix or #svg suffixes
+		var suffix string
+		if i := strings.IndexAny(ref, "?#"); i >= 0 {
+			ref, suffix = ref[:i], ref[i:]
+		}
+		target := resolveStaticPath(dir, ref)
+		if strings.HasPrefix(target, "../") {
+			return match
+		}
+		if mapped, ok := assetManifest[target]; ok {
+			target = mapped
+		}
+		return `url("` + withBasePath(target) + suffix + `")`
+	})
+
+	for i, bundle := range inlined {
+		css = strings.Replace(css, fmt.Sprintf("/*@import %d*/", i), bundle, 1)
+	}
+	return css, nil
+}
+
+// stripCSSComments removes comments other than /*! license */ ones. Strings
+// and unquoted url()s are copied as they are, since a /* inside them does
+// not start a comment
+func stripCSSComments(css string) string {
+	var out strings.Builder
+	for i := 0; i < len(css); i++ {
+		switch c := css[i]; {
+		case c == '"' || c == '\'':
+			start := i
+			for i++; i < len(css) && css[i] != c && css[i] != '\n'; i++ {
+				if css[i] == '\\' {
+					i++
+				}
+			}
+			out.WriteString(css[start:min(i+1, len(css))])
+		case strings.HasPrefix(strings.ToLower(css[i:]), "url("):
+			rest := strings.TrimLeft(css[i+4:], " \t\n\r\f")
+			if rest == "" || rest[0] == '"' || rest[0] == '\'' {
+				out.WriteString(css[i : i+4])
+				i += 3
+				continue
+			}
+			end := strings.IndexByte(css[i:], ')')
+			if end < 0 {
+				end = len(css) - i - 1
+			}
+			out.WriteString(css[i : i+end+1])
+			i += end
+		case c == '/' && i+1 < len(css) && css[i+1] == '*':
+			end := strings.Index(css[i+2:], "*/")
+			if end < 0 {
+				end = len(css) - i - 4
+			}
+			if i+2 < len(css) && css[i+2] == '!' {
+				out.WriteString(css[i : i+end+4])
+			}
+			i += end + 3
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
 
-		return os.WriteFile(dstPath, srcData, 0644)
+// hoistCSSImports moves the @imports left in a bundle (external ones) to
+// its top, since browsers ignore an @import that follows other rules
+func hoistCSSImports(css string) string {
+	var hoisted []string
+	css = cssImportRegex.ReplaceAllStringFunc(css, func(match string) string {
+		hoisted = append(hoisted, match)
+		return ""
 	})
+	if len(hoisted) == 0 {
+		return css
+	}
+	return strings.Join(hoisted, "\n") + "\n" + css
+}
+
+// resolveStaticPath resolves a reference in a stylesheet under dir to a
+// slash path from the static root; "/x" is already from the root
+func resolveStaticPath(dir, ref string) string {
+	if strings.HasPrefix(ref, "/") {
+		return strings.TrimPrefix(path.Clean(ref), "/")
+	}
+	return path.Join(dir, ref)
+}
+
+// isExternalURL reports whether ref points off the site
+func isExternalURL(ref string) bool {
+	return strings.Contains(ref, "://") || strings.HasPrefix(ref, "//")
+}
 
-	return err
+// fingerprintExts are the static files that get content-hashed names;
+// anything else (robots.txt, CNAME, ...) keeps its name
+var fingerprintExts = map[string]bool{
+	".css": true, ".js": true, ".png": true, ".jpg": true, ".jpeg": true,
+	".gif": true, ".webp": true, ".svg": true, ".ico": true,
+	".woff": true, ".woff2": true,
+}
+
+// writeAsset writes a static file to the output directory under name
+// (a slash path like css/style.css), fingerprinted when that is on, and
+// records it in the asset manifest with its SRI hash
+func writeAsset(name string, data []byte) error {
+	contentHash := sha256.Sum256(data)
+	integrityHash := sha512.Sum384(data)
+	assetIntegrity[name] = "sha384-" + base64.StdEncoding.EncodeToString(integrityHash[:])
+
+	outName := name
+	ext := path.Ext(name)
+	if site.Assets.Fingerprint && fingerprintExts[strings.ToLower(ext)] {
+		outName = strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(contentHash[:])[:10] + ext
+	}
+	assetManifest[name] = outName
+
+	dstPath := filepath.Join(outputDir, filepath.FromSlash(outName))
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(dstPath, data, 0644); err != nil {
+		return err
+	}
+	if outName != name && site.Assets.KeepOriginals {
+		return os.WriteFile(filepath.Join(outputDir, filepath.FromSlash(name)), data, 0644)
+	}
+	return nil
+}
+
+// writeAssetManifest writes assets.json, mapping each static file to the
+// name it was written under, for anything outside the templates
+func writeAssetManifest() error {
+	manifest, err := json.MarshalIndent(assetManifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, "assets.json"), append(manifest, '\n'), 0644)
 }
 
 func copyImages() error {
@@ -948,108 +3376,364 @@ func copyImages() error {
 	return nil
 }
 
+// responsiveImage is a content image's intrinsic size and the narrower
+// variants made from it, as stored in the image cache
+type responsiveImage struct {
+	Width    int            `json:"width"`
+	Height   int            `json:"height"`
+	Variants []imageVariant `json:"variants"`
+}
+
+// imageVariant is one resized copy, written to the cache as {key}-{width}w{ext}
+type imageVariant struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Ext    string `json:"ext"`
+	File   string `json:"file"`
+}
+
+var (
+	// responsiveImages holds the images already looked up, by source path
+	responsiveImages = map[string]*responsiveImage{}
+	imagesResized    int
+	imagesCached     int
+)
+
+// responsiveImageAttrs returns the width, height, srcset and sizes
+// attributes for an img tag whose src is srcPath on disk, written to
+// destPath and linked as publicURL. The variants it links to are added to
+// variants, by output path. Attributes the tag already has are left alone,
+// and SVGs get none since they scale on their own
+func responsiveImageAttrs(tag, srcPath, destPath, publicURL, sizes string, variants map[string]string) (string, error) {
+	if strings.ToLower(filepath.Ext(srcPath)) == ".svg" {
+		return "", nil
+	}
+	img, err := loadResponsiveImage(srcPath)
+	if err != nil {
+		return "", err
+	}
+
+	var attrs strings.Builder
+	if !strings.Contains(tag, " width=") && !strings.Contains(tag, " height=") {
+		fmt.Fprintf(&attrs, ` width="%d" height="%d"`, img.Width, img.Height)
+	}
+	if len(img.Variants) == 0 || strings.Contains(tag, " srcset=") {
+		return attrs.String(), nil
+	}
+
+	dir := publicURL[:strings.LastIndex(publicURL, "/")+1]
+	stem := strings.TrimSuffix(filepath.Base(destPath), filepath.Ext(destPath))
+	var candidates []string
+	for _, variant := range img.Variants {
+		name := fmt.Sprintf("%s-%dw%s", stem, variant.Width, variant.Ext)
+		variants[filepath.Join(filepath.Dir(destPath), name)] = filepath.Join(imageCacheDir, variant.File)
+		candidates = append(candidates, fmt.Sprintf("%s%s %dw", dir, url.PathEscape(name), variant.Width))
+	}
+	candidates = append(candidates, fmt.Sprintf("%s %dw", publicURL, img.Width))
+	fmt.Fprintf(&attrs, ` srcset="%s" sizes="%s"`, strings.Join(candidates, ", "), template.HTMLEscapeString(sizes))
+	return attrs.String(), nil
+}
+
+// imageSizes is the sizes attribute for images in the given layout
+func imageSizes(layout string) string {
+	if sizes, ok := site.Images.LayoutSizes[layout]; ok {
+		return sizes
+	}
+	return site.Images.Sizes
+}
+
+// loadResponsiveImage returns the size and variants of the image at
+// srcPath. Results are cached under imageCacheDir by a hash of the file and
+// the image settings, so an unchanged image is only decoded once
+func loadResponsiveImage(srcPath string) (*responsiveImage, error) {
+	if img, ok := responsiveImages[srcPath]; ok {
+		return img, nil
+	}
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	hash.Write(data)
+	fmt.Fprintf(hash, "%v %d", site.Images.Widths, site.Images.Quality)
+	key := hex.EncodeToString(hash.Sum(nil))[:20]
+	indexPath := filepath.Join(imageCacheDir, key+".json")
+
+	if img, err := readImageCache(indexPath); err == nil {
+		responsiveImages[srcPath] = img
+		imagesCached++
+		return img, nil
+	}
+
+	if err := os.MkdirAll(imageCacheDir, 0755); err != nil {
+		return nil, err
+	}
+	img, err := resizeImage(data, key)
+	if err != nil {
+		return nil, err
+	}
+	index, err := json.Marshal(img)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(indexPath, index, 0644); err != nil {
+		return nil, err
+	}
+	responsiveImages[srcPath] = img
+	imagesResized++
+	return img, nil
+}
+
+// readImageCache reads a cache index, failing if any variant it lists has
+// gone missing
+func readImageCache(indexPath string) (*responsiveImage, error) {
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	var img responsiveImage
+	if err := json.Unmarshal(data, &img); err != nil {
+		return nil, err
+	}
+	for _, variant := range img.Variants {
+		if _, err := os.Stat(filepath.Join(imageCacheDir, variant.File)); err != nil {
+			return nil, err
+		}
+	}
+	return &img, nil
+}
+
+// resizeImage decodes an image and writes a variant to the cache for every
+// configured width narrower than the original. GIFs only get their size
+// read, since resizing would drop the animation frames
+func resizeImage(data []byte, key string) (*responsiveImage, error) {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("difficulty in decoding: %w", err)
+	}
+	bounds := src.Bounds()
+	img := &responsiveImage{Width: bounds.Dx(), Height: bounds.Dy()}
+	if format == "gif" {
+		return img, nil
+	}
+
+	for _, width := range site.Images.Widths {
+		if width >= img.Width {
+			break
+		}
+		if n := len(img.Variants); n > 0 && img.Variants[n-1].Width == width {
+			continue
+		}
+		height := max(1, (img.Height*width+img.Width/2)/img.Width)
+		dst := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+		var buf bytes.Buffer
+		ext, err := encodeImage(&buf, dst, format, isOpaque(src))
+		if err != nil {
+			return nil, fmt.Errorf("difficulty in encoding the %dw variant: %w", width, err)
+		}
+		file := fmt.Sprintf("%s-%dw%s", key, width, ext)
+		if err := os.WriteFile(filepath.Join(imageCacheDir, file), buf.Bytes(), 0644); err != nil {
+			return nil, err
+		}
+		img.Variants = append(img.Variants, imageVariant{Width: width, Height: height, Ext: ext, File: file})
+	}
+	return img, nil
+}
+
+// encodeImage writes img in the source format and returns its extension.
+// There is no WebP encoder in Go, so WebP sources become JPEG, or PNG when
+// they have transparency
+func encodeImage(w io.Writer, img image.Image, format string, opaque bool) (string, error) {
+	switch {
+	case format == "png", format == "webp" && !opaque:
+		return ".png", png.Encode(w, img)
+	default:
+		return ".jpg", jpeg.Encode(w, img, &jpeg.Options{Quality: site.Images.Quality})
+	}
+}
+
+// isOpaque reports whether an image has no transparent pixels
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// writeImageVariants copies the variants published posts and pages link to
+// from the cache into the output directory
+func writeImageVariants(variants map[string]string) error {
+	for _, destPath := range sortedKeys(variants) {
+		data, err := os.ReadFile(variants[destPath])
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(destPath, data, 0644); err != nil {
+			return err
+		}
+	}
+	if count := len(variants); count > 0 {
+		fmt.Printf("▓▓ COPIED %d IMAGE VARIANT%s (%d RESIZED, %d CACHED)\n", count, strings.ToUpper(plural(count)), imagesResized, imagesCached)
+	}
+	return nil
+}
+
 func generateRSSFeed(posts []PostTemplateData) error {
+	return writeRSSFeed(posts, "", site.Title, site.Description)
+}
+
+// generateCategoryRSSFeed writes writings/category/{name}/rss.xml
+func generateCategoryRSSFeed(category string, posts []PostTemplateData) error {
+	return writeRSSFeed(posts, "writings/category/"+category+"/",
+		site.Title+": "+category, "Writings filed under "+category+" by "+site.Author)
+}
+
+// getSiteURL returns the scheme and host of the site without a trailing
+// slash; basePath goes after it
+func getSiteURL() string {
+	return site.BaseURL
+}
+
+// writeRSSFeed writes an RSS feed of posts to {feedDir}rss.xml, where
+// feedDir is a site path relative to basePath ("" for the site root)
+// xmlText escapes s for use as XML character data or an attribute value
+func xmlText(s string) string {
+	var buf strings.Builder
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func writeRSSFeed(posts []PostTemplateData, feedDir, title, description string) error {
+	// Drafts and scheduled posts only exist in previews and must never
+	// reach a feed
+	var published []PostTemplateData
+	for _, post := range posts {
+		if !post.IsDraft && !post.IsScheduled {
+			published = append(published, post)
+		}
+	}
+	posts = published
+
 	if len(posts) == 0 {
 		return nil // No posts, skip RSS generation
 	}
 
-	rssPath := filepath.Join(outputDir, "rss.xml")
-	file, err := os.Create(rssPath)
-	if err != nil {
-		return fmt.Errorf("could not create RSS file: %w", err)
-	}
-	defer file.Close()
-
-	// Get site URL from environment variable or use default
-	siteURL := os.Getenv("SITE_URL")
-	if siteURL == "" {
-		siteURL = "https://thisiskarthik.com"
-		if basePath != "/" {
-			// For GitHub Pages project sites, construct URL from basePath
-			path := strings.Trim(basePath, "/")
-			if path != "" {
-				// Try to extract username from path or use default
-				username := os.Getenv("GITHUB_USERNAME")
-				if username == "" {
-					username = "karthi209"
-				}
-				siteURL = fmt.Sprintf("https://%s.github.io/%s", username, path)
-			}
-		}
+	rssPath := filepath.Join(outputDir, filepath.FromSlash(feedDir), "rss.xml")
+	if err := os.MkdirAll(filepath.Dir(rssPath), 0755); err != nil {
+		return fmt.Errorf("could not create RSS directory: %w", err)
 	}
-	// Ensure siteURL doesn't end with /
-	siteURL = strings.TrimSuffix(siteURL, "/")
+	var rss bytes.Buffer
+
+	siteURL := getSiteURL()
 
 	// Get current time for feed date
 	now := time.Now().UTC().Format(time.RFC1123Z)
 
 	// Write RSS header
-	rssLink := fmt.Sprintf("%s%s", siteURL, basePath)
-	rssLink = strings.TrimSuffix(rssLink, "/")
-	fmt.Fprintf(file, `<?xml version="1.0" encoding="UTF-8"?>
-<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+	channelURL := fmt.Sprintf("%s%s%s", siteURL, basePath, feedDir)
+	rssLink := strings.TrimSuffix(channelURL, "/")
+	fmt.Fprintf(&rss, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom" xmlns:dcterms="http://purl.org/dc/terms/">
 <channel>
-<title>The Nonsense Buffer</title>
+<title>%s</title>
 <link>%s</link>
-<description>Writings and observations by Karthik</description>
-<language>en-us</language>
+<description>%s</description>
+<language>%s</language>
 <lastBuildDate>%s</lastBuildDate>
 <atom:link href="%srss.xml" rel="self" type="application/rss+xml"/>
-`, rssLink, now, rssLink)
+`, xmlText(title), xmlText(rssLink), xmlText(description), xmlText(site.Feed.Language), now, xmlText(channelURL))
 
-	// Write RSS items (limit to 20 most recent)
-	maxItems := 20
+	// Write RSS items (limit to the most recent feed.limit)
+	maxItems := site.Feed.Limit
 	if len(posts) < maxItems {
 		maxItems = len(posts)
 	}
 
 	for i := 0; i < maxItems; i++ {
 		post := posts[i]
-		postURL := fmt.Sprintf("%s%swritings/%s", siteURL, basePath, post.Slug)
+		postURL := fmt.Sprintf("%s%swritings/%s", siteURL, basePath, url.PathEscape(post.Slug))
 
 		// Use CreatedAt time directly
 		pubDate := post.CreatedAt.UTC().Format(time.RFC1123Z)
 
 		// Clean HTML content for description (strip tags, limit length)
-		// Simple HTML tag removal
-		description := string(post.Content)
-		// Remove HTML tags
-		for {
-			start := strings.Index(description, "<")
-			if start == -1 {
-				break
-			}
-			end := strings.Index(description[start:], ">")
-			if end == -1 {
-				break
-			}
-			description = description[:start] + " " + description[start+end+1:]
-		}
-		// Clean up whitespace
-		description = strings.TrimSpace(description)
-		// Replace HTML entities
-		description = strings.ReplaceAll(description, "&nbsp;", " ")
-		description = strings.ReplaceAll(description, "&amp;", "&")
-		description = strings.ReplaceAll(description, "&lt;", "<")
-		description = strings.ReplaceAll(description, "&gt;", ">")
+		description := stripTags(string(post.Content))
 		// Limit length
 		if len(description) > 500 {
 			description = description[:500] + "..."
 		}
 
-		fmt.Fprintf(file, `<item>
+		fmt.Fprintf(&rss, `<item>
 <title><![CDATA[%s]]></title>
 <link>%s</link>
 <guid isPermaLink="true">%s</guid>
 <pubDate>%s</pubDate>
+<atom:updated>%s</atom:updated>
 <description><![CDATA[%s]]></description>
-</item>
-`, post.Title, postURL, postURL, pubDate, description)
+%s</item>
+`, post.Title, postURL, postURL, pubDate, post.UpdatedAt.UTC().Format(time.RFC3339), description, rssItemExtras(siteURL, post))
 	}
 
 	// Write RSS footer
-	fmt.Fprintf(file, `</channel>
+	fmt.Fprintf(&rss, `</channel>
 </rss>`)
 
+	feed, err := minifyAsset("RSS", "text/xml", rss.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(rssPath, feed, 0644); err != nil {
+		return fmt.Errorf("could not write RSS file: %w", err)
+	}
 	return nil
 }
+
+// stripTags removes HTML tags from content and decodes entities
+func stripTags(content string) string {
+	// Simple HTML tag removal
+	text := content
+	for {
+		start := strings.Index(text, "<")
+		if start == -1 {
+			break
+		}
+		end := strings.Index(text[start:], ">")
+		if end == -1 {
+			break
+		}
+		text = text[:start] + " " + text[start+end+1:]
+	}
+	// Clean up whitespace
+	text = strings.TrimSpace(text)
+	// Replace HTML entities
+	text = strings.ReplaceAll(text, "&nbsp;", " ")
+	return html.UnescapeString(text)
+}
+
+// rssItemExtras renders the optional cover image enclosure and edition of
+// an RSS item
+func rssItemExtras(siteURL string, post PostTemplateData) string {
+	var extras strings.Builder
+	if post.CoverImage != "" {
+		coverFile := filepath.Join(imagesDir, filepath.FromSlash(strings.TrimPrefix(post.CoverImage, basePath+"images/")))
+		var length int64
+		if info, err := os.Stat(coverFile); err == nil {
+			length = info.Size()
+		}
+		mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(coverFile)))
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		fmt.Fprintf(&extras, "<enclosure url=\"%s%s\" length=\"%d\" type=\"%s\"/>\n", siteURL, post.CoverImage, length, mimeType)
+	}
+	if post.Edition != "" {
+		fmt.Fprintf(&extras, "<dcterms:hasVersion><![CDATA[%s]]></dcterms:hasVersion>\n", post.Edition)
+	}
+	return extras.String()
+}
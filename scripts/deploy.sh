@@ -14,20 +14,27 @@ NC='\033[0m' # No Color
 echo -e "${BLUE}Deploying site to GitHub Pages...${NC}"
 echo ""
 
-# Get base path from environment or default to "/" for custom domain
-BASE_PATH="${BASE_PATH:-/}"
-
-# Ensure BASE_PATH ends with / (unless it's just "/")
-if [ "$BASE_PATH" != "/" ] && [ "${BASE_PATH: -1}" != "/" ]; then
-    BASE_PATH="${BASE_PATH}/"
+# BASE_PATH from the environment overrides base_path in site.yaml; left
+# unset, the config decides
+if [ -n "$BASE_PATH" ]; then
+    # Ensure BASE_PATH ends with / (unless it's just "/")
+    if [ "$BASE_PATH" != "/" ] && [ "${BASE_PATH: -1}" != "/" ]; then
+        BASE_PATH="${BASE_PATH}/"
+    fi
+    export BASE_PATH
+    echo -e "${BLUE}Base path: ${YELLOW}$BASE_PATH${NC}"
+else
+    echo -e "${BLUE}Base path: ${YELLOW}from site.yaml${NC}"
 fi
-
-echo -e "${BLUE}Base path: ${YELLOW}$BASE_PATH${NC}"
 echo ""
 
-# Step 1: Build the site
+# Step 1: Build the site, minified unless MINIFY=false
+GENERATE_FLAGS="--minify"
+if [ "${MINIFY:-true}" = "false" ]; then
+    GENERATE_FLAGS=""
+fi
 echo -e "${BLUE}[1/6] Building site...${NC}"
-if BASE_PATH="$BASE_PATH" make generate; then
+if make generate GENERATE_FLAGS="$GENERATE_FLAGS"; then
     echo -e "${GREEN}✓${NC} Site built successfully"
 else
     echo -e "${RED}✗${NC} Build failed"
@@ -173,7 +180,7 @@ echo -e "${GREEN}✓${NC} Deployed to gh-pages branch"
 echo -e "${GREEN}✓${NC} Pushed to GitHub"
 echo ""
 echo -e "${BLUE}Your site should be available at:${NC}"
-if [ "$BASE_PATH" = "/" ]; then
+if [ -z "$BASE_PATH" ] || [ "$BASE_PATH" = "/" ]; then
     echo -e "${YELLOW}https://<your-username>.github.io/${NC}"
 else
     echo -e "${YELLOW}https://<your-username>.github.io${BASE_PATH}${NC}"
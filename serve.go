@@ -3,18 +3,21 @@ package main
 import (
 	"context"
 	"fmt"
+	"html"
 	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -22,6 +25,41 @@ var (
 	reloadMutex   sync.Mutex
 )
 
+// siteDirs are the directories from site.yaml the dev server cares about
+type siteDirs struct {
+	Content   string `yaml:"content"`
+	Output    string `yaml:"output"`
+	Templates string `yaml:"templates"`
+	Static    string `yaml:"static"`
+	// Theme is the theme directory, from the top-level theme key
+	Theme string `yaml:"-"`
+}
+
+// configPath returns the site config file, site.yaml unless SITE_CONFIG is set
+func configPath() string {
+	if path := os.Getenv("SITE_CONFIG"); path != "" {
+		return path
+	}
+	return "site.yaml"
+}
+
+// loadSiteDirs reads the dirs section of the site config, falling back to
+// the defaults the generator uses
+func loadSiteDirs() siteDirs {
+	cfg := struct {
+		Theme string   `yaml:"theme"`
+		Dirs  siteDirs `yaml:"dirs"`
+	}{Dirs: siteDirs{Content: "content", Output: "public", Templates: "templates", Static: "static"}}
+	if content, err := os.ReadFile(configPath()); err == nil {
+		// The generator reports config errors on the first build
+		_ = yaml.Unmarshal(content, &cfg)
+	}
+	if cfg.Theme != "" {
+		cfg.Dirs.Theme = filepath.Join("themes", cfg.Theme)
+	}
+	return cfg.Dirs
+}
+
 func getLocalIPs() []string {
 	addrs := []string{}
 	ifaces, err := net.Interfaces()
@@ -57,7 +95,8 @@ func getLocalIPs() []string {
 }
 
 func rebuildSite() error {
-	cmd := exec.Command("go", "run", "generate.go")
+	// Preview drafts and scheduled posts locally; make generate leaves them out
+	cmd := exec.Command("go", "run", "generate.go", "--build-future", "--drafts")
 	// Suppress output - only show errors
 	cmd.Stdout = nil
 	cmd.Stderr = nil
@@ -83,15 +122,21 @@ func rebuildSite() error {
 	return err
 }
 
-func watchFiles() (*fsnotify.Watcher, error) {
+func watchFiles(dirs siteDirs) (*fsnotify.Watcher, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, err
 	}
 
 	// Watch directories
-	dirs := []string{"templates", "content", "static"}
-	for _, dir := range dirs {
+	watchDirs := []string{dirs.Templates, dirs.Content, dirs.Static}
+	if dirs.Theme != "" {
+		// A missing theme is reported by the build, not the watcher
+		if _, err := os.Stat(dirs.Theme); err == nil {
+			watchDirs = append(watchDirs, dirs.Theme)
+		}
+	}
+	for _, dir := range watchDirs {
 		if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
@@ -113,11 +158,28 @@ func watchFiles() (*fsnotify.Watcher, error) {
 		}
 	}
 
+	// Watch the site config
+	watcher.Add(configPath())
+
 	return watcher, nil
 }
 
+// aliasRefreshRegex matches the meta refresh written into alias pages
+var aliasRefreshRegex = regexp.MustCompile(`<meta http-equiv="refresh" content="0; url=([^"]+)">`)
+
+// aliasTarget returns the redirect target of an alias page, or "" if the
+// page is not an alias
+func aliasTarget(content []byte) string {
+	match := aliasRefreshRegex.FindSubmatch(content)
+	if match == nil {
+		return ""
+	}
+	return html.UnescapeString(string(match[1]))
+}
+
 func main() {
-	outputDir := "public"
+	dirs := loadSiteDirs()
+	outputDir := dirs.Output
 	port := "5174"
 
 	// Initial build
@@ -254,6 +316,12 @@ func main() {
 					return
 				}
 
+				// Alias pages for renamed posts get a real redirect
+				if target := aliasTarget(content); target != "" {
+					http.Redirect(w, r, target, http.StatusMovedPermanently)
+					return
+				}
+
 				// Inject reload script before </body> or at end of file
 				htmlContent := string(content)
 				reloadScript := `<script>
@@ -297,7 +365,7 @@ func main() {
 	})
 
 	// Setup file watcher
-	watcher, err := watchFiles()
+	watcher, err := watchFiles(dirs)
 	if err != nil {
 		// Silent failure - server will run without auto-rebuild
 	} else {
@@ -324,10 +392,13 @@ func main() {
 						}
 					}
 					
-					// Ignore chmod events and only watch for write/create/remove
+					// Ignore chmod events and only watch for write/create/remove/rename
+					// (renames cover editors that save by swapping files, and
+					// moving a CSS partial around)
 					if event.Op&fsnotify.Write == fsnotify.Write ||
 						event.Op&fsnotify.Create == fsnotify.Create ||
-						event.Op&fsnotify.Remove == fsnotify.Remove {
+						event.Op&fsnotify.Remove == fsnotify.Remove ||
+						event.Op&fsnotify.Rename == fsnotify.Rename {
 						// Debounce: wait 300ms before rebuilding
 						if rebuildTimer != nil {
 							rebuildTimer.Stop()